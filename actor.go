@@ -1,6 +1,7 @@
 package enforcer
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -23,12 +24,26 @@ func (a *Actor) Validate() error {
 
 func (a Actor) String() string { return fmt.Sprintf("Actor{id='%s'}", a.ID) }
 
+// ActorResolver implementation resolves the actor (i.e., attributes of the
+// actor) with given ID. ErrNotFound must be returned if the actor does not
+// exist. See the resolver package for implementations.
+type ActorResolver interface {
+	Resolve(ctx context.Context, actorID string) (*Actor, error)
+}
+
+// ActorResolverFunc implements ActorResolver using a function.
+type ActorResolverFunc func(ctx context.Context, actorID string) (*Actor, error)
+
+func (fn ActorResolverFunc) Resolve(ctx context.Context, actorID string) (*Actor, error) {
+	return fn(ctx, actorID)
+}
+
 // Action represents an activity/action executed by an actor.
 type Action struct {
-	ID      string                 `json:"id"`
+	ID      string                 `json:"id" validate:"required"`
 	Time    time.Time              `json:"time"`
 	Data    map[string]interface{} `json:"data"`
-	ActorID string                 `json:"actor_id"`
+	ActorID string                 `json:"actor_id" validate:"required"`
 }
 
 // Validate performs validation of given action.
@@ -38,16 +53,7 @@ func (act *Action) Validate() error {
 	if act.Time.IsZero() {
 		act.Time = time.Now()
 	}
-
-	if act.ID == "" {
-		return ErrInvalid.WithMsgf("id cannot be empty")
-	}
-
-	if act.ActorID == "" {
-		return ErrInvalid.WithMsgf("actor_id cannot be empty")
-	}
-
-	return nil
+	return invalidFields(val.Struct(act))
 }
 
 func (act Action) String() string {
@@ -3,18 +3,33 @@ package enforcer
 import (
 	"context"
 	"errors"
+	"sort"
 	"strings"
 	"time"
 )
 
+// maxIngestAttempts is the number of times Ingest works out the changes for
+// an action when the commit fails due to a concurrent change.
+const maxIngestAttempts = 3
+
 // API provides functions for managing campaigns.
 type API struct {
 	Store  Store
 	Engine ruleEngine
+
+	// Order decides the order in which active enrolments are tried
+	// during Ingest. DefaultOrder is used if not set.
+	Order OrderFn
+
+	// RecordEvents enables recording of the enrolment lifecycle events
+	// in the store outbox along with the enrolment changes made by Enrol
+	// and Ingest. Use Relay to publish the recorded events.
+	RecordEvents bool
 }
 
 type ruleEngine interface {
 	Exec(_ context.Context, rule string, data interface{}) (bool, error)
+	Check(_ context.Context, rule string, data interface{}) error
 }
 
 // GetCampaign returns campaign with given ID. Returns ErrNotFound if not found.
@@ -28,20 +43,39 @@ func (api *API) GetCampaign(ctx context.Context, id string) (*Campaign, error) {
 	return api.Store.GetCampaign(ctx, id)
 }
 
-// ListCampaigns returns a list of campaigns matching the given search query.
-func (api *API) ListCampaigns(ctx context.Context, q Query) ([]Campaign, error) {
-	res, err := api.Store.ListCampaigns(ctx, q)
+// ListCampaigns returns a page of campaigns matching the given search query
+// along with the cursor for the next page (empty if there are no more).
+func (api *API) ListCampaigns(ctx context.Context, q Query) ([]Campaign, string, error) {
+	if _, _, err := ParseSort(q.Sort); err != nil {
+		return nil, "", err
+	}
+
+	if f, ok := api.Store.(CampaignFilterer); ok && f.FiltersCampaigns() {
+		return api.Store.ListCampaigns(ctx, q)
+	}
+
+	// store returns unfiltered results. so pagination must be applied
+	// after filtering.
+	allQ := q
+	allQ.Page = Page{}
+	res, _, err := api.Store.ListCampaigns(ctx, allQ)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return q.filterCampaigns(res), nil
+	return PaginateCampaigns(q.filterCampaigns(res), q)
 }
 
 // CreateCampaign validates and inserts a new campaign into the storage. Campaign ID is
 // assigned automatically and the stored version of the campaign is returned.
+// Eligibility and step rules are compiled and ErrInvalid is returned if any of
+// them is not valid.
 func (api *API) CreateCampaign(ctx context.Context, camp Campaign) (*Campaign, error) {
+	camp.Version = 1
+	camp.UpdatedBy = authorOf(ctx)
 	if err := camp.Validate(); err != nil {
 		return nil, err
+	} else if err := api.checkRules(ctx, camp); err != nil {
+		return nil, err
 	}
 
 	if err := api.Store.CreateCampaign(ctx, camp); err != nil {
@@ -52,7 +86,11 @@ func (api *API) CreateCampaign(ctx context.Context, camp Campaign) (*Campaign, e
 
 // UpdateCampaign merges the given partial campaign object with the existing campaign and
 // stores. The updated version is returned. Some fields may not undergo update
-// based on current usage status.
+// based on current usage status. Steps of a campaign in use can be updated only if
+// the store has the revisions of all its versions, since existing enrolments then
+// continue with the steps of the version they started on. Version of the campaign is incremented on every
+// update and ErrConflict is returned if updates.Version is set and is not the
+// current version.
 func (api *API) UpdateCampaign(ctx context.Context, id string, updates Updates) (*Campaign, error) {
 	id = strings.TrimSpace(id)
 	if !idPattern.MatchString(id) {
@@ -61,19 +99,188 @@ func (api *API) UpdateCampaign(ctx context.Context, id string, updates Updates)
 			WithCausef("must match '%s'", idPattern)
 	}
 
+	pinned, err := api.canPinSteps(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
 	updateFn := func(ctx context.Context, actual *Campaign) error {
-		if err := actual.apply(updates); err != nil {
+		if err := CheckVersion(*actual, updates.Version); err != nil {
+			return err
+		} else if err := actual.apply(updates, pinned); err != nil {
+			return err
+		} else if err := api.checkRules(ctx, *actual); err != nil {
 			return err
 		}
+		actual.Version++
 		actual.UpdatedAt = time.Now()
+		actual.UpdatedBy = authorOf(ctx)
 		return nil
 	}
 
 	return api.Store.UpdateCampaign(ctx, id, updateFn)
 }
 
-// DeleteCampaign deletes a campaign by the identifier.
-func (api *API) DeleteCampaign(ctx context.Context, id string) error {
+// ListRevisions returns all versions of the campaign (including the current
+// one) in the order of version. Returns ErrUnsupported if the store does not
+// implement RevisionStore.
+func (api *API) ListRevisions(ctx context.Context, id string) ([]Revision, error) {
+	revStore, err := api.revisionStore()
+	if err != nil {
+		return nil, err
+	}
+
+	camp, err := api.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := revStore.ListRevisions(ctx, camp.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Revision, 0, len(stored)+1)
+	for _, c := range stored {
+		res = append(res, revisionOf(c))
+	}
+	return append(res, revisionOf(*camp)), nil
+}
+
+// GetRevision returns the given version of the campaign. Returns ErrNotFound
+// if the campaign has no such version.
+func (api *API) GetRevision(ctx context.Context, id string, version int) (*Revision, error) {
+	revStore, err := api.revisionStore()
+	if err != nil {
+		return nil, err
+	}
+
+	camp, err := api.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if camp.Version == version {
+		rev := revisionOf(*camp)
+		return &rev, nil
+	}
+
+	c, err := revStore.GetRevision(ctx, camp.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	rev := revisionOf(*c)
+	return &rev, nil
+}
+
+// DiffRevisions returns the changes in the campaign definition from one
+// version of the campaign to the other.
+func (api *API) DiffRevisions(ctx context.Context, id string, from, to int) ([]Change, error) {
+	fromRev, err := api.GetRevision(ctx, id, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toRev, err := api.GetRevision(ctx, id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := diffCampaigns(fromRev.Campaign, toRev.Campaign)
+	if err != nil {
+		return nil, ErrInternal.WithCausef("failed to diff revisions: %v", err)
+	}
+	return changes, nil
+}
+
+// RollbackCampaign restores the definition of the campaign from the given
+// revision as a new version. Restrictions on updates of a campaign that is
+// in use apply as in UpdateCampaign. ErrConflict is returned if ifVersion is
+// non-zero and is not the current version. Rolling back to the current
+// version is a no-op and returns the campaign as is.
+func (api *API) RollbackCampaign(ctx context.Context, id string, version, ifVersion int) (*Campaign, error) {
+	camp, err := api.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if camp.Version == version {
+		if err := CheckVersion(*camp, ifVersion); err != nil {
+			return nil, err
+		}
+		return camp, nil
+	}
+
+	rev, err := api.GetRevision(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned, err := api.canPinSteps(ctx, rev.Campaign.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	updateFn := func(ctx context.Context, actual *Campaign) error {
+		if err := CheckVersion(*actual, ifVersion); err != nil {
+			return err
+		} else if err := actual.restore(rev.Campaign, pinned); err != nil {
+			return err
+		} else if err := api.checkRules(ctx, *actual); err != nil {
+			return err
+		}
+		actual.Version++
+		actual.UpdatedAt = time.Now()
+		actual.UpdatedBy = authorOf(ctx)
+		return nil
+	}
+
+	return api.Store.UpdateCampaign(ctx, rev.Campaign.ID, updateFn)
+}
+
+// canPinSteps returns true if every enrolment of the campaign can be pinned to
+// the version it started on, i.e., if the store has the revisions of all the
+// earlier versions of the campaign. Campaigns updated before the store kept
+// revisions (or created before versions) do not have the full history.
+func (api *API) canPinSteps(ctx context.Context, id string) (bool, error) {
+	revStore, ok := api.Store.(RevisionStore)
+	if !ok {
+		return false, nil
+	}
+
+	camp, err := api.Store.GetCampaign(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	revs, err := revStore.ListRevisions(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return hasFullHistory(*camp, revs), nil
+}
+
+// hasFullHistory returns true if revs contains every version of the campaign
+// before the current one. Versions start at 1.
+func hasFullHistory(camp Campaign, revs []Campaign) bool {
+	if len(revs) != camp.Version-1 {
+		return false
+	}
+	for i, rev := range revs {
+		if rev.Version != i+1 {
+			return false
+		}
+	}
+	return true
+}
+
+func (api *API) revisionStore() (RevisionStore, error) {
+	revStore, ok := api.Store.(RevisionStore)
+	if !ok {
+		return nil, ErrUnsupported.WithCausef("store does not keep campaign revisions")
+	}
+	return revStore, nil
+}
+
+// DeleteCampaign deletes a campaign by the identifier. If version is non-zero,
+// ErrConflict is returned if it is not the current version of the campaign.
+func (api *API) DeleteCampaign(ctx context.Context, id string, version int) error {
 	id = strings.TrimSpace(id)
 	if !idPattern.MatchString(id) {
 		return ErrInvalid.
@@ -81,7 +288,7 @@ func (api *API) DeleteCampaign(ctx context.Context, id string) error {
 			WithCausef("must match '%s'", idPattern)
 	}
 
-	return api.Store.DeleteCampaign(ctx, id)
+	return api.Store.DeleteCampaign(ctx, id, version)
 }
 
 // GetEnrolment returns an enrolment for campaign and an actor. If actor is not
@@ -110,28 +317,54 @@ func (api *API) GetEnrolment(ctx context.Context, id string, ac Actor) (*Enrolme
 }
 
 // ListExistingEnrolments returns a list of existing enrolments in one of given statuses.
-// The returned list will not include eligible enrolments.
-func (api *API) ListExistingEnrolments(ctx context.Context, actorID string, status []string) ([]Enrolment, error) {
-	existing, err := api.Store.ListEnrolments(ctx, actorID)
+// The returned list will not include eligible enrolments. Only the current cycle of
+// recurring campaigns is included unless includePast is set.
+func (api *API) ListExistingEnrolments(ctx context.Context, actorID string, status []string, includePast bool) ([]Enrolment, error) {
+	existing, _, err := api.Store.ListEnrolments(ctx, actorID, Page{})
 	if err != nil {
 		return nil, err
 	}
+
+	if includePast {
+		var all []Enrolment
+		for _, enr := range existing {
+			if enr.Iteration == 0 {
+				all = append(all, enr)
+				continue
+			}
+
+			history, err := api.Store.ListEnrolmentHistory(ctx, actorID, enr.CampaignID)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, history...)
+		}
+		existing = all
+	}
 	return filterByStatus(existing, status), nil
 }
 
-// ListAllEnrolments returns all enrolments including existing and eligible. Eligible
-// are computed based on the campaign query and actor data provided.
-func (api *API) ListAllEnrolments(ctx context.Context, ac Actor, campQ Query) ([]Enrolment, error) {
-	existing, err := api.ListExistingEnrolments(ctx, ac.ID, nil)
+// ListAllEnrolments returns a page of all enrolments including existing and eligible.
+// Eligible are computed based on the campaign query and actor data provided. Results
+// are ordered as per campQ.Sort using the attributes of the enrolment's campaign.
+func (api *API) ListAllEnrolments(ctx context.Context, ac Actor, campQ Query) ([]Enrolment, string, error) {
+	field, desc, err := ParseSort(campQ.Sort)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	existing, err := api.ListExistingEnrolments(ctx, ac.ID, nil, false)
+	if err != nil {
+		return nil, "", err
 	}
 
+	page := campQ.Page
+	campQ.Page = Page{}
 	campQ.OnlyActive = true
 	campQ.Include = collectCampaignIDs(existing)
-	camps, err := api.ListCampaigns(ctx, campQ)
+	camps, _, err := api.ListCampaigns(ctx, campQ)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var res []Enrolment
@@ -142,7 +375,9 @@ func (api *API) ListAllEnrolments(ctx context.Context, ac Actor, campQ Query) ([
 		res = append(res, enrolment)
 	}
 
+	campaigns := map[string]Campaign{}
 	for _, camp := range camps {
+		campaigns[camp.ID] = camp
 		if _, exists := alreadyEnrolled[camp.ID]; exists {
 			continue
 		}
@@ -152,15 +387,34 @@ func (api *API) ListAllEnrolments(ctx context.Context, ac Actor, campQ Query) ([
 			if errors.Is(err, ErrIneligible) {
 				continue
 			}
-			return nil, err
+			return nil, "", err
 		}
 		res = append(res, *enr)
 	}
-	return res, nil
+
+	idx, next, err := paginate(len(res), sortString(field, desc), desc, page, func(i int) Cursor {
+		camp, found := campaigns[res[i].CampaignID]
+		if !found {
+			camp = Campaign{EndAt: res[i].EndsAt}
+		}
+		return Cursor{Key: SortKey(camp, field), ID: res[i].CampaignID}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	paged := make([]Enrolment, 0, len(idx))
+	for _, i := range idx {
+		paged = append(paged, res[i])
+	}
+	return paged, next, nil
 }
 
 // Enrol binds the given actor to the campaign. Boolean flag will be set only if
-// a new enrolment is created.
+// a new enrolment is created. Returns ErrLimitReached if the campaign already
+// has MaxEnrolments enrolments. If the campaign is recurring and the current
+// cycle of the actor is over, a new cycle is started as per the Recurrence
+// policy (see Enrolment.Iteration).
 func (api *API) Enrol(ctx context.Context, campaignID string, ac Actor) (*Enrolment, bool, error) {
 	campaignID = strings.TrimSpace(campaignID)
 	if !idPattern.MatchString(campaignID) {
@@ -170,72 +424,322 @@ func (api *API) Enrol(ctx context.Context, campaignID string, ac Actor) (*Enrolm
 	}
 
 	enr, err := api.Store.GetEnrolment(ctx, ac.ID, campaignID)
-	if !errors.Is(err, ErrNotFound) {
-		enr.setStatus()
-		return enr, false, err
+	if err == nil {
+		if err := api.checkExpiry(ctx, enr); err != nil {
+			return nil, false, err
+		}
+
+		if enr.Status != StatusCompleted && enr.Status != StatusExpired {
+			return enr, false, nil
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, false, err
 	}
 
 	camp, err := api.GetCampaign(ctx, campaignID)
 	if err != nil {
+		if enr != nil && errors.Is(err, ErrNotFound) {
+			return enr, false, nil
+		}
 		return nil, false, err
 	}
 
-	newEnr, err := api.prepEnrolment(ctx, *camp, ac)
+	iteration := 0
+	if enr != nil {
+		if err := camp.canReEnrol(*enr, time.Now()); err != nil {
+			return enr, false, nil
+		}
+		iteration = enr.Iteration + 1
+	}
+
+	newEnr, err := api.newEnrolment(ctx, *camp, ac, iteration)
 	if err != nil {
 		return nil, false, err
+	} else if err := newEnr.validate(); err != nil {
+		return nil, false, err
 	}
 
-	newEnr.StartedAt = time.Now()
-	newEnr.EndsAt = camp.EndAt
-	if camp.Deadline > 0 {
-		// relative end_date due to deadline (in days)
-		newEnr.EndsAt = newEnr.StartedAt.AddDate(0, 0, camp.Deadline)
+	newEnr.Version++
+	enrolled := api.events(newEvent(EventEnrolled, *newEnr, -1, "", newEnr.StartedAt))
+	if err := api.Store.UpsertEnrolment(ctx, *newEnr, enrolled...); err != nil {
+		return nil, false, err
 	}
-	newEnr.setStatus()
-
-	return newEnr, true, api.Store.UpsertEnrolment(ctx, *newEnr)
+	return newEnr, true, nil
 }
 
 // Ingest processes the action within current enrolments and returns the list of
 // enrolments that progressed. If completeMulti is false, only one enrolment will
-// be progressed.
+// be progressed. Enrolments are tried in the order defined by api.Order (or by
+// DefaultOrder if not set). If the store implements IngestLog, re-ingesting an
+// action with the same ID returns the originally recorded results.
+//
+// Actor is also enrolled into the active campaigns with AutoEnrol set if the
+// actor is eligible and not enrolled already (or can start a new cycle of a
+// recurring campaign), and the action is then applied to those enrolments too.
+//
+// Lifecycle events are recorded along with the changes if api.RecordEvents is set.
 func (api *API) Ingest(ctx context.Context, completeMulti bool, ac Actor, act Action) ([]IngestResult, error) {
 	if err := act.Validate(); err != nil {
 		return nil, err
 	}
 
-	applicable, err := api.ListExistingEnrolments(ctx, ac.ID, []string{StatusActive})
+	ingestLog, hasLog := api.Store.(IngestLog)
+	if !hasLog {
+		res, _, _, err := api.progress(ctx, completeMulti, ac, act, false)
+		return res, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		recorded, err := ingestLog.GetIngested(ctx, ac.ID, act.ID)
+		if err == nil {
+			return recorded, nil
+		} else if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+
+		res, enrolments, events, err := api.progress(ctx, completeMulti, ac, act, true)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ingestLog.CommitIngested(ctx, ac.ID, act.ID, res, enrolments, events)
+		if err == nil {
+			return res, nil
+		}
+
+		// a concurrent ingest of the same action (or another action of the
+		// actor changing the same enrolments) got committed first or the
+		// campaign got full. the changes are worked out again from the
+		// latest state.
+		isStale := errors.Is(err, ErrConflict) || errors.Is(err, ErrLimitReached)
+		if !isStale || attempt >= maxIngestAttempts {
+			return nil, err
+		}
+	}
+}
+
+// progress applies the action to the applicable enrolments of the actor. If
+// deferWrites is set, the changed enrolments and the events are returned to
+// be stored by the caller. Otherwise, they are stored as they are made.
+func (api *API) progress(ctx context.Context, completeMulti bool, ac Actor, act Action, deferWrites bool) ([]IngestResult, []Enrolment, []Event, error) {
+	existing, err := api.ListExistingEnrolments(ctx, ac.ID, nil, false)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+
+	for i := range existing {
+		if err := api.checkExpiry(ctx, &existing[i]); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	autoEnrols, err := api.autoEnrolCandidates(ctx, ac, existing)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	applicable, err := api.sortApplicable(ctx, filterByStatus(existing, []string{StatusActive}), autoEnrols)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	api.sortApplicable(applicable)
 
 	var res []IngestResult
-	var isAffected bool
-	var completionErr error
-	for _, enr := range applicable {
-		isAffected, completionErr = api.applyCompletion(ctx, ac, act, &enr)
-		if completionErr != nil {
-			break
-		} else if isAffected {
-			if completionErr = api.Store.UpsertEnrolment(ctx, enr); completionErr != nil {
-				break
+	var changed []Enrolment
+	var recorded []Event
+	for _, cand := range applicable {
+		enr := cand.Enrolment
+
+		var result *IngestResult
+		if completeMulti || len(res) == 0 {
+			result, err = api.applyCompletion(ctx, cand.Campaign, ac, act, &enr)
+			if err != nil {
+				return res, changed, recorded, err
+			}
+		}
+
+		var events []Event
+		if result != nil {
+			result.ActionID = act.ID
+			result.CampaignID = enr.CampaignID
+			result.Enrolled = cand.isNew
+			events = ingestEvents(*result, enr, act)
+		} else if cand.isNew {
+			// actor is auto-enrolled based on the eligibility even if the
+			// action does not progress the enrolment.
+			events = []Event{newEvent(EventEnrolled, enr, -1, act.ID, act.Time)}
+		} else {
+			continue
+		}
+
+		enr.Version++
+		if err := enr.validate(); err != nil {
+			return res, changed, recorded, err
+		}
+
+		events = api.events(events...)
+		if deferWrites {
+			changed = append(changed, enr)
+			recorded = append(recorded, events...)
+		} else if err := api.Store.UpsertEnrolment(ctx, enr, events...); err != nil {
+			if cand.isNew && errors.Is(err, ErrLimitReached) {
+				// campaign got full since the candidate was prepared.
+				continue
 			}
-			res = append(res, IngestResult{
-				StepID:     enr.CompletedSteps[len(enr.CompletedSteps)-1].StepID,
-				ActionID:   act.ID,
-				CampaignID: enr.CampaignID,
-			})
-			if !completeMulti {
-				break
+			return res, changed, recorded, err
+		}
+
+		if result != nil {
+			res = append(res, *result)
+		}
+	}
+	return res, changed, recorded, nil
+}
+
+func (api *API) autoEnrolCandidates(ctx context.Context, ac Actor, existing []Enrolment) ([]Candidate, error) {
+	camps, _, err := api.ListCampaigns(ctx, Query{OnlyActive: true, OnlyAutoEnrol: true})
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[string]Enrolment{}
+	for _, enr := range existing {
+		latest[enr.CampaignID] = enr
+	}
+
+	now := time.Now()
+	var res []Candidate
+	for _, camp := range camps {
+		iteration := 0
+		if last, enrolled := latest[camp.ID]; enrolled {
+			if camp.canReEnrol(last, now) != nil {
+				continue
 			}
+			iteration = last.Iteration + 1
+		}
+
+		enr, err := api.newEnrolment(ctx, camp, ac, iteration)
+		if err != nil {
+			if errors.Is(err, ErrIneligible) || errors.Is(err, ErrLimitReached) {
+				continue
+			}
+			return nil, err
+		}
+		res = append(res, Candidate{Enrolment: *enr, Campaign: camp, isNew: true})
+	}
+	return res, nil
+}
+
+func (api *API) sortApplicable(ctx context.Context, applicable []Enrolment, extra []Candidate) ([]Candidate, error) {
+	res := make([]Candidate, 0, len(applicable)+len(extra))
+	for _, enr := range applicable {
+		camp, err := api.GetCampaign(ctx, enr.CampaignID)
+		if err != nil {
+			return nil, err
+		}
+
+		pinned, err := api.pinCampaign(ctx, *camp, &enr)
+		if err != nil {
+			return nil, err
+		} else if pinned == nil {
+			// steps the enrolment started on are not known. it is not
+			// progressed rather than evaluated against other steps.
+			continue
 		}
+		res = append(res, Candidate{Enrolment: enr, Campaign: *pinned})
+	}
+	res = append(res, extra...)
+
+	less := api.Order
+	if less == nil {
+		less = DefaultOrder
 	}
-	return res, completionErr
+	sort.SliceStable(res, func(i, j int) bool {
+		return less(res[i], res[j])
+	})
+	return res, nil
 }
 
-func (api *API) sortApplicable(applicable []Enrolment) {
-	// TODO: sort based on priority, end_date etc.
+// pinCampaign returns the campaign with the steps and rewards of the version
+// the enrolment started on. Current version is returned as is if the store
+// does not keep revisions. Enrolments that started before the versions were
+// recorded on them are assigned the version based on the time they started.
+// Returns nil if the version cannot be determined.
+func (api *API) pinCampaign(ctx context.Context, camp Campaign, enr *Enrolment) (*Campaign, error) {
+	revStore, ok := api.Store.(RevisionStore)
+	if !ok || enr.CampaignVersion == camp.Version {
+		return &camp, nil
+	}
+
+	if enr.CampaignVersion == 0 {
+		revs, err := revStore.ListRevisions(ctx, camp.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !hasFullHistory(camp, revs) {
+			// steps of such a campaign are never edited while it is in use.
+			// so the enrolment is on the current steps.
+			enr.CampaignVersion = camp.Version
+			return &camp, nil
+		}
+
+		enr.CampaignVersion = versionAt(camp, revs, enr.StartedAt)
+		if enr.CampaignVersion == 0 {
+			return nil, nil
+		} else if enr.CampaignVersion == camp.Version {
+			return &camp, nil
+		}
+	}
+
+	rev, err := revStore.GetRevision(ctx, camp.ID, enr.CampaignVersion)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	camp.Steps = rev.Steps
+	camp.IsUnordered = rev.IsUnordered
+	camp.Rewards = rev.Rewards
+	return &camp, nil
+}
+
+// versionAt returns the version of the campaign that was current at the
+// given time or 0 if the campaign did not exist then.
+func versionAt(camp Campaign, revs []Campaign, at time.Time) int {
+	version := 0
+	for _, c := range append(revs, camp) {
+		if !c.UpdatedAt.After(at) && c.Version > version {
+			version = c.Version
+		}
+	}
+	return version
+}
+
+// newEnrolment prepares a new active enrolment of the actor into the given cycle
+// of the campaign. The returned enrolment is not stored.
+func (api *API) newEnrolment(ctx context.Context, camp Campaign, ac Actor, iteration int) (*Enrolment, error) {
+	if iteration == 0 && camp.MaxEnrolments > 0 && camp.CurEnrolments >= camp.MaxEnrolments {
+		return nil, ErrLimitReached.
+			WithCausef("campaign '%s' allows only %d enrolments", camp.ID, camp.MaxEnrolments)
+	}
+
+	newEnr, err := api.prepEnrolment(ctx, camp, ac)
+	if err != nil {
+		return nil, err
+	}
+
+	newEnr.Iteration = iteration
+	newEnr.CampaignVersion = camp.Version
+	newEnr.StartedAt = time.Now()
+	newEnr.EndsAt = camp.EndAt
+	if camp.Deadline > 0 {
+		// relative end_date due to deadline (in days)
+		newEnr.EndsAt = newEnr.StartedAt.AddDate(0, 0, camp.Deadline)
+	}
+	newEnr.setStatus()
+	return newEnr, nil
 }
 
 func (api *API) prepEnrolment(ctx context.Context, camp Campaign, ac Actor) (*Enrolment, error) {
@@ -258,18 +762,50 @@ func (api *API) checkEligibility(ctx context.Context, camp Campaign, ac Actor) e
 
 	isPass, err := api.Engine.Exec(ctx, camp.Eligibility, ruleExecEnv(ac, nil))
 	if err != nil {
-		return err
+		return ErrUnprocessable.
+			WithMsgf("eligibility rule of campaign '%s' could not be evaluated", camp.ID).
+			WithCausef("%v", err)
 	} else if !isPass {
 		return ErrIneligible
 	}
 	return nil
 }
 
-func (api *API) applyCompletion(ctx context.Context, ac Actor, act Action, enr *Enrolment) (bool, error) {
-	camp, err := api.GetCampaign(ctx, enr.CampaignID)
-	if err != nil {
-		return false, err
+// CheckVersion returns ErrConflict if version is set and is not the current
+// version of the campaign. Stores use it for conditional deletes.
+func CheckVersion(camp Campaign, version int) error {
+	if version != 0 && camp.Version != version {
+		return ErrConflict.
+			WithMsgf("campaign '%s' has been modified", camp.ID).
+			WithCausef("version %d is not the current version %d", version, camp.Version)
+	}
+	return nil
+}
+
+func (api *API) checkRules(ctx context.Context, camp Campaign) error {
+	if camp.Eligibility != "" {
+		if err := api.Engine.Check(ctx, camp.Eligibility, ruleExecEnv(Actor{}, nil)); err != nil {
+			return ErrInvalid.
+				WithMsgf("eligibility rule is not valid").
+				WithCausef("%v", err)
+		}
+	}
+
+	stepEnv := ruleExecEnv(Actor{}, &Action{})
+	for i, step := range camp.Steps {
+		if err := api.Engine.Check(ctx, step.Rule, stepEnv); err != nil {
+			return ErrInvalid.
+				WithMsgf("step rule %d is not valid", i).
+				WithCausef("%v", err)
+		}
 	}
+	return nil
+}
+
+// applyCompletion applies the action on the next applicable step(s) of the
+// enrolment. Returns the result of the step that progressed or nil if the
+// action did not progress the enrolment.
+func (api *API) applyCompletion(ctx context.Context, camp Campaign, ac Actor, act Action, enr *Enrolment) (*IngestResult, error) {
 	env := ruleExecEnv(ac, &act)
 
 	if camp.IsUnordered {
@@ -282,44 +818,82 @@ func (api *API) applyCompletion(ctx context.Context, ac Actor, act Action, enr *
 				continue
 			}
 
-			pass, err := api.Engine.Exec(ctx, step, env)
-			if err != nil {
-				return false, err
-			} else if pass {
-				enr.CompletedSteps = append(enr.CompletedSteps, StepResult{
-					StepID:   i,
-					DoneAt:   act.Time,
-					ActionID: act.ID,
-				})
-				enr.TotalSteps = len(camp.Steps)
-				return true, nil
+			res, err := api.applyStep(ctx, camp, i, step, env, act, enr)
+			if err != nil || res != nil {
+				return res, err
 			}
 		}
 
-		return false, nil
+		return nil, nil
 	}
 
 	nextStepID := len(enr.CompletedSteps)
 	if nextStepID >= len(camp.Steps) {
-		return false, ErrInternal.WithMsgf("campaign has lesser steps than enrolment")
+		return nil, ErrInternal.WithMsgf("campaign has lesser steps than enrolment")
 	}
 
-	pass, err := api.Engine.Exec(ctx, camp.Steps[nextStepID], env)
-	if err != nil || !pass {
-		return false, err
+	return api.applyStep(ctx, camp, nextStepID, camp.Steps[nextStepID], env, act, enr)
+}
+
+// applyStep records the progress of the enrolment in the step if the action
+// matches the step rule. Aggregated steps are completed only when the target
+// is reached.
+func (api *API) applyStep(ctx context.Context, camp Campaign, stepID int, step Step, env map[string]interface{}, act Action, enr *Enrolment) (*IngestResult, error) {
+	pass, err := api.Engine.Exec(ctx, step.Rule, env)
+	if err != nil {
+		return nil, ErrUnprocessable.
+			WithMsgf("rule of step %d of campaign '%s' could not be evaluated", stepID, camp.ID).
+			WithCausef("%v", err)
+	} else if !pass {
+		return nil, nil
+	}
+
+	var value float64
+	if step.Aggregate != "" {
+		prog := enr.progressOf(stepID)
+		if !step.accumulate(prog, act) {
+			if prog.UpdatedAt.IsZero() {
+				// drop the empty progress added above.
+				enr.clearProgress(stepID)
+			}
+			return nil, nil
+		}
+
+		if value = prog.Value; value < step.Target {
+			return &IngestResult{StepID: stepID, Value: value, Partial: true}, nil
+		}
+		enr.clearProgress(stepID)
 	}
 
 	enr.CompletedSteps = append(enr.CompletedSteps, StepResult{
-		StepID:   nextStepID,
+		StepID:   stepID,
 		DoneAt:   act.Time,
 		ActionID: act.ID,
+		Value:    value,
 	})
 	enr.TotalSteps = len(camp.Steps)
-	return true, nil
+
+	rewards := camp.rewardsFor(stepID, *enr)
+	for _, r := range rewards {
+		enr.Rewards = append(enr.Rewards, GrantedReward{
+			Reward:    r,
+			GrantedAt: act.Time,
+			ActionID:  act.ID,
+		})
+	}
+	return &IngestResult{StepID: stepID, Value: value, Rewards: rewards}, nil
 }
 
+// IngestResult represents the progress made by an action in an enrolment.
+// Partial is set if the action progressed an aggregated step without
+// completing it. Value is the aggregate of the step after the action.
+// Rewards contains the rewards granted due to the action (if any).
 type IngestResult struct {
-	StepID     int    `json:"step_id"`
-	ActionID   string `json:"action_id"`
-	CampaignID string `json:"campaign_id"`
+	StepID     int      `json:"step_id"`
+	ActionID   string   `json:"action_id"`
+	CampaignID string   `json:"campaign_id"`
+	Enrolled   bool     `json:"enrolled,omitempty"`
+	Value      float64  `json:"value,omitempty"`
+	Partial    bool     `json:"partial,omitempty"`
+	Rewards    []Reward `json:"rewards,omitempty"`
 }
@@ -1 +1,847 @@
-package enforcer
+package enforcer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/publisher"
+	"github.com/spy16/enforcer/rule"
+	"github.com/spy16/enforcer/stores/inmem"
+)
+
+func TestAPI_Enrol_MaxEnrolments(t *testing.T) {
+	t.Parallel()
+
+	const maxEnrolments = 3
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+
+	now := time.Now()
+	_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:            "capped",
+		Enabled:       true,
+		StartAt:       now.Add(-1 * time.Hour),
+		EndAt:         now.Add(1 * time.Hour),
+		Steps:         []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+		MaxEnrolments: maxEnrolments,
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	enrolled, limited := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, isNew, err := api.Enrol(ctx, "capped", enforcer.Actor{ID: fmt.Sprintf("actor_%d", i)})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				assert.Truef(t, errors.Is(err, enforcer.ErrLimitReached), "unexpected error: %v", err)
+				limited++
+			} else if isNew {
+				enrolled++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, maxEnrolments, enrolled)
+	assert.Equal(t, 10-maxEnrolments, limited)
+
+	camp, err := api.GetCampaign(ctx, "capped")
+	require.NoError(t, err)
+	assert.Equal(t, maxEnrolments, camp.CurEnrolments)
+}
+
+func TestAPI_Ingest_Order(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	ac := enforcer.Actor{ID: "actor_1"}
+
+	now := time.Now()
+	for _, camp := range []enforcer.Campaign{
+		{ID: "low_priority", Priority: 1},
+		{ID: "high_priority_b", Priority: 10},
+		{ID: "high_priority_a", Priority: 10},
+	} {
+		camp.Enabled = true
+		camp.StartAt = now.Add(-1 * time.Hour)
+		camp.EndAt = now.Add(1 * time.Hour)
+		camp.Steps = []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}, {Rule: "event.type == 'REVIEW'"}}
+
+		_, err := api.CreateCampaign(ctx, camp)
+		require.NoError(t, err)
+
+		_, _, err = api.Enrol(ctx, camp.ID, ac)
+		require.NoError(t, err)
+	}
+
+	res, err := api.Ingest(ctx, false, ac, enforcer.Action{
+		ID:      "act_1",
+		ActorID: ac.ID,
+		Data:    map[string]interface{}{"type": "PURCHASE"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "high_priority_a", res[0].CampaignID)
+
+	api.Order = func(a, b enforcer.Candidate) bool {
+		return a.Campaign.Priority < b.Campaign.Priority
+	}
+	res, err = api.Ingest(ctx, false, ac, enforcer.Action{
+		ID:      "act_2",
+		ActorID: ac.ID,
+		Data:    map[string]interface{}{"type": "PURCHASE"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "low_priority", res[0].CampaignID)
+}
+
+func TestAPI_Ingest_Idempotent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	ac := enforcer.Actor{ID: "actor_1"}
+
+	now := time.Now()
+	_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:      "repeat",
+		Enabled: true,
+		StartAt: now.Add(-1 * time.Hour),
+		EndAt:   now.Add(1 * time.Hour),
+		Steps:   []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}, {Rule: "event.type == 'PURCHASE'"}},
+	})
+	require.NoError(t, err)
+	_, _, err = api.Enrol(ctx, "repeat", ac)
+	require.NoError(t, err)
+
+	act := enforcer.Action{
+		ID:      "act_1",
+		ActorID: ac.ID,
+		Data:    map[string]interface{}{"type": "PURCHASE"},
+	}
+
+	first, err := api.Ingest(ctx, false, ac, act)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+
+	second, err := api.Ingest(ctx, false, ac, act)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	enr, err := api.GetEnrolment(ctx, "repeat", ac)
+	require.NoError(t, err)
+	assert.Len(t, enr.CompletedSteps, 1)
+	assert.Equal(t, enforcer.StatusActive, enr.Status)
+}
+
+func TestAPI_CreateCampaign_InvalidRules(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	table := []struct {
+		title       string
+		eligibility string
+		steps       []enforcer.Step
+		wantMsg     string
+	}{
+		{
+			title:   "InvalidStepSyntax",
+			steps:   []enforcer.Step{{Rule: "event.type == 'REGISTER'"}, {Rule: "event.type = 'PURCHASE'"}},
+			wantMsg: "step rule 1 is not valid",
+		},
+		{
+			title:   "UnknownVariableInStep",
+			steps:   []enforcer.Step{{Rule: "evnt.type == 'PURCHASE'"}},
+			wantMsg: "step rule 0 is not valid",
+		},
+		{
+			title:       "EventInEligibility",
+			eligibility: "event.type == 'PURCHASE'",
+			steps:       []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+			wantMsg:     "eligibility rule is not valid",
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+
+			_, err := api.CreateCampaign(context.Background(), enforcer.Campaign{
+				ID:          "invalid",
+				StartAt:     now,
+				EndAt:       now.Add(1 * time.Hour),
+				Eligibility: tt.eligibility,
+				Steps:       tt.steps,
+			})
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, enforcer.ErrInvalid))
+
+			var e enforcer.Error
+			require.True(t, errors.As(err, &e))
+			assert.Equal(t, tt.wantMsg, e.Message)
+			assert.NotEmpty(t, e.Cause)
+		})
+	}
+}
+
+func TestAPI_UpdateCampaign_Version(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+
+	now := time.Now()
+	camp, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:      "camp_1",
+		Version: 10,
+		StartAt: now.Add(1 * time.Hour),
+		EndAt:   now.Add(2 * time.Hour),
+		Steps:   []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, camp.Version)
+
+	priority := 5
+	updated, err := api.UpdateCampaign(ctx, "camp_1", enforcer.Updates{Version: 1, Priority: &priority})
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+
+	updated, err = api.UpdateCampaign(ctx, "camp_1", enforcer.Updates{Priority: &priority})
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.Version, "version must be incremented without expected version")
+
+	_, err = api.UpdateCampaign(ctx, "camp_1", enforcer.Updates{Version: 2, Priority: &priority})
+	assert.True(t, errors.Is(err, enforcer.ErrConflict))
+
+	err = api.DeleteCampaign(ctx, "camp_1", 2)
+	assert.True(t, errors.Is(err, enforcer.ErrConflict))
+
+	require.NoError(t, api.DeleteCampaign(ctx, "camp_1", 3))
+	_, err = api.GetCampaign(ctx, "camp_1")
+	assert.True(t, errors.Is(err, enforcer.ErrNotFound))
+}
+
+func TestAPI_Revisions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+
+	now := time.Now()
+	_, err := api.CreateCampaign(enforcer.WithAuthor(ctx, "alice"), enforcer.Campaign{
+		ID:      "camp_1",
+		Enabled: true,
+		StartAt: now.Add(-1 * time.Hour),
+		EndAt:   now.Add(1 * time.Hour),
+		Steps:   []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+	})
+	require.NoError(t, err)
+
+	steps := []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}, {Rule: "event.type == 'REVIEW'"}}
+	deadline := 7
+	_, err = api.UpdateCampaign(enforcer.WithAuthor(ctx, "bob"), "camp_1", enforcer.Updates{Steps: steps, Deadline: &deadline})
+	require.NoError(t, err)
+
+	revs, err := api.ListRevisions(ctx, "camp_1")
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	assert.Equal(t, 1, revs[0].Version)
+	assert.Equal(t, "alice", revs[0].Author)
+	assert.Len(t, revs[0].Campaign.Steps, 1)
+	assert.Equal(t, 2, revs[1].Version)
+	assert.Equal(t, "bob", revs[1].Author)
+
+	changes, err := api.DiffRevisions(ctx, "camp_1", 1, 2)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "deadline", changes[0].Field)
+	assert.Equal(t, "steps[1]", changes[1].Field)
+	assert.Nil(t, changes[1].From)
+
+	_, err = api.DiffRevisions(ctx, "camp_1", 1, 5)
+	assert.True(t, errors.Is(err, enforcer.ErrNotFound))
+
+	rolledBack, err := api.RollbackCampaign(enforcer.WithAuthor(ctx, "carol"), "camp_1", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, rolledBack.Version)
+	assert.Equal(t, "carol", rolledBack.UpdatedBy)
+	assert.Len(t, rolledBack.Steps, 1)
+
+	_, err = api.RollbackCampaign(ctx, "camp_1", 2, 2)
+	assert.True(t, errors.Is(err, enforcer.ErrConflict), "stale version must be rejected")
+
+	current, err := api.RollbackCampaign(ctx, "camp_1", 3, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, current.Version, "rollback to the current version must be a no-op")
+	revs, err = api.ListRevisions(ctx, "camp_1")
+	require.NoError(t, err)
+	assert.Len(t, revs, 3)
+
+	_, err = api.RollbackCampaign(ctx, "camp_1", 3, 2)
+	assert.True(t, errors.Is(err, enforcer.ErrConflict), "stale version must be rejected")
+
+	// deadline of a campaign in use cannot be rolled back.
+	_, _, err = api.Enrol(ctx, "camp_1", enforcer.Actor{ID: "actor_1"})
+	require.NoError(t, err)
+
+	_, err = api.RollbackCampaign(ctx, "camp_1", 2, 0)
+	assert.True(t, errors.Is(err, enforcer.ErrInvalid))
+}
+
+func TestAPI_Ingest_PinnedRevision(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+
+	now := time.Now()
+	_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:      "camp_1",
+		Enabled: true,
+		StartAt: now.Add(-1 * time.Hour),
+		EndAt:   now.Add(1 * time.Hour),
+		Steps:   []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+	})
+	require.NoError(t, err)
+
+	old, _, err := api.Enrol(ctx, "camp_1", enforcer.Actor{ID: "actor_1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, old.CampaignVersion)
+
+	// steps can be edited while in use since enrolments are pinned.
+	steps := []enforcer.Step{{Rule: "event.type == 'REVIEW'"}, {Rule: "event.type == 'SHARE'"}}
+	_, err = api.UpdateCampaign(ctx, "camp_1", enforcer.Updates{Steps: steps})
+	require.NoError(t, err)
+
+	newEnr, _, err := api.Enrol(ctx, "camp_1", enforcer.Actor{ID: "actor_2"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, newEnr.CampaignVersion)
+	assert.Equal(t, 2, newEnr.TotalSteps)
+
+	purchase := func(actorID string) []enforcer.IngestResult {
+		res, err := api.Ingest(ctx, false, enforcer.Actor{ID: actorID}, enforcer.Action{
+			ID:      "purchase_" + actorID,
+			ActorID: actorID,
+			Time:    now,
+			Data:    map[string]interface{}{"type": "PURCHASE"},
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	assert.Len(t, purchase("actor_1"), 1, "existing enrolment must follow the steps it started on")
+	assert.Empty(t, purchase("actor_2"), "new enrolment must follow the current steps")
+
+	enr, err := api.GetEnrolment(ctx, "camp_1", enforcer.Actor{ID: "actor_1"})
+	require.NoError(t, err)
+	assert.Equal(t, enforcer.StatusCompleted, enr.Status)
+}
+
+func TestAPI_Ingest_UnpinnedEnrolment(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	purchase := enforcer.Action{
+		ID:      "purchase_1",
+		ActorID: "actor_1",
+		Time:    now,
+		Data:    map[string]interface{}{"type": "PURCHASE"},
+	}
+	steps := []enforcer.Step{{Rule: "event.type == 'REVIEW'"}}
+
+	t.Run("Backfilled", func(t *testing.T) {
+		st := &inmem.Store{}
+		api := &enforcer.API{Store: st, Engine: rule.New()}
+
+		_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+			ID:      "camp_1",
+			Enabled: true,
+			StartAt: now.Add(-1 * time.Hour),
+			EndAt:   now.Add(1 * time.Hour),
+			Steps:   []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+		})
+		require.NoError(t, err)
+
+		// enrolment from before the versions were recorded on enrolments.
+		legacy := enforcer.Enrolment{
+			Status:     enforcer.StatusActive,
+			ActorID:    "actor_1",
+			CampaignID: "camp_1",
+			StartedAt:  time.Now(),
+			EndsAt:     now.Add(1 * time.Hour),
+			TotalSteps: 1,
+		}
+		require.NoError(t, st.UpsertEnrolment(ctx, legacy))
+
+		_, err = api.UpdateCampaign(ctx, "camp_1", enforcer.Updates{Steps: steps})
+		require.NoError(t, err)
+
+		res, err := api.Ingest(ctx, false, enforcer.Actor{ID: "actor_1"}, purchase)
+		require.NoError(t, err)
+		assert.Len(t, res, 1, "enrolment must follow the steps of the version current when it started")
+
+		enr, err := api.GetEnrolment(ctx, "camp_1", enforcer.Actor{ID: "actor_1"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, enr.CampaignVersion)
+	})
+
+	t.Run("WithoutHistory", func(t *testing.T) {
+		st := &inmem.Store{}
+		api := &enforcer.API{Store: st, Engine: rule.New()}
+
+		// campaign from before the versions were kept.
+		require.NoError(t, st.CreateCampaign(ctx, enforcer.Campaign{
+			ID:      "camp_1",
+			Enabled: true,
+			StartAt: now.Add(-1 * time.Hour),
+			EndAt:   now.Add(1 * time.Hour),
+			Steps:   []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+		}))
+		require.NoError(t, st.UpsertEnrolment(ctx, enforcer.Enrolment{
+			Status:     enforcer.StatusActive,
+			ActorID:    "actor_1",
+			CampaignID: "camp_1",
+			StartedAt:  now,
+			EndsAt:     now.Add(1 * time.Hour),
+			TotalSteps: 1,
+		}))
+
+		_, err := api.UpdateCampaign(ctx, "camp_1", enforcer.Updates{Steps: steps})
+		assert.True(t, errors.Is(err, enforcer.ErrInvalid), "steps must not be editable without full history")
+
+		res, err := api.Ingest(ctx, false, enforcer.Actor{ID: "actor_1"}, purchase)
+		require.NoError(t, err)
+		assert.Len(t, res, 1)
+	})
+}
+
+func TestAPI_ListAllEnrolments_Pagination(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	ac := enforcer.Actor{ID: "actor_1"}
+
+	now := time.Now()
+	for i, id := range []string{"camp_a", "camp_b", "camp_c"} {
+		_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+			ID:       id,
+			Enabled:  true,
+			StartAt:  now.Add(-1 * time.Hour),
+			EndAt:    now.Add(1 * time.Hour),
+			Steps:    []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+			Priority: i,
+		})
+		require.NoError(t, err)
+	}
+	_, _, err := api.Enrol(ctx, "camp_a", ac)
+	require.NoError(t, err)
+
+	q := enforcer.Query{Sort: "-priority", Page: enforcer.Page{Limit: 2}}
+	res, next, err := api.ListAllEnrolments(ctx, ac, q)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.NotEmpty(t, next)
+	assert.Equal(t, "camp_c", res[0].CampaignID)
+	assert.Equal(t, "camp_b", res[1].CampaignID)
+
+	q.Cursor = next
+	res, next, err = api.ListAllEnrolments(ctx, ac, q)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Empty(t, next)
+	assert.Equal(t, "camp_a", res[0].CampaignID)
+	assert.Equal(t, enforcer.StatusActive, res[0].Status)
+
+	_, _, err = api.ListAllEnrolments(ctx, ac, enforcer.Query{Sort: "name"})
+	assert.True(t, errors.Is(err, enforcer.ErrInvalid))
+}
+
+func TestAPI_Ingest_AutoEnrol(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	ac := enforcer.Actor{ID: "actor_1", Attribs: map[string]interface{}{"blocked": false}}
+
+	now := time.Now()
+	_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:          "onboarding",
+		Enabled:     true,
+		StartAt:     now.Add(-1 * time.Hour),
+		EndAt:       now.Add(1 * time.Hour),
+		Eligibility: "not actor.blocked",
+		Steps:       []enforcer.Step{{Rule: "event.type == 'REGISTER_ACCOUNT'"}, {Rule: "event.type == 'PURCHASE'"}},
+		AutoEnrol:   true,
+	})
+	require.NoError(t, err)
+
+	res, err := api.Ingest(ctx, false, ac, enforcer.Action{
+		ID:      "act_1",
+		ActorID: ac.ID,
+		Data:    map[string]interface{}{"type": "PURCHASE"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	camp, err := api.GetCampaign(ctx, "onboarding")
+	require.NoError(t, err)
+	assert.Equal(t, 1, camp.CurEnrolments, "eligible actor must be enrolled even if the action does not progress")
+
+	res, err = api.Ingest(ctx, false, ac, enforcer.Action{
+		ID:      "act_2",
+		ActorID: ac.ID,
+		Data:    map[string]interface{}{"type": "REGISTER_ACCOUNT"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, enforcer.IngestResult{
+		StepID:     0,
+		ActionID:   "act_2",
+		CampaignID: "onboarding",
+		Enrolled:   false,
+	}, res[0])
+
+	enr, err := api.GetEnrolment(ctx, "onboarding", ac)
+	require.NoError(t, err)
+	assert.Equal(t, enforcer.StatusActive, enr.Status)
+	require.Len(t, enr.CompletedSteps, 1)
+	assert.Equal(t, "act_2", enr.CompletedSteps[0].ActionID)
+
+	res, err = api.Ingest(ctx, false, ac, enforcer.Action{
+		ID:      "act_3",
+		ActorID: ac.ID,
+		Data:    map[string]interface{}{"type": "PURCHASE"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.False(t, res[0].Enrolled)
+
+	blocked := enforcer.Actor{ID: "actor_2", Attribs: map[string]interface{}{"blocked": true}}
+	res, err = api.Ingest(ctx, false, blocked, enforcer.Action{
+		ID:      "act_4",
+		ActorID: blocked.ID,
+		Data:    map[string]interface{}{"type": "REGISTER_ACCOUNT"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, res, "ineligible actor must not be auto-enrolled")
+}
+
+func TestAPI_Enrol_Recurring(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	ac := enforcer.Actor{ID: "actor_1"}
+
+	now := time.Now()
+	for _, camp := range []enforcer.Campaign{
+		{ID: "weekly", Recurrence: &enforcer.Recurrence{MaxCycles: 2}},
+		{ID: "cooldown", Recurrence: &enforcer.Recurrence{Cooldown: 7}},
+		{ID: "once"},
+	} {
+		camp.Enabled = true
+		camp.StartAt = now.Add(-1 * time.Hour)
+		camp.EndAt = now.Add(1 * time.Hour)
+		camp.Steps = []enforcer.Step{{Rule: "event.type == 'RIDE'"}}
+		_, err := api.CreateCampaign(ctx, camp)
+		require.NoError(t, err)
+	}
+
+	complete := func(actionID string) {
+		t.Helper()
+		_, err := api.Ingest(ctx, true, ac, enforcer.Action{
+			ID:      actionID,
+			ActorID: ac.ID,
+			Data:    map[string]interface{}{"type": "RIDE"},
+		})
+		require.NoError(t, err)
+	}
+
+	for _, id := range []string{"weekly", "cooldown", "once"} {
+		enr, isNew, err := api.Enrol(ctx, id, ac)
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, 0, enr.Iteration)
+
+		_, isNew, err = api.Enrol(ctx, id, ac)
+		require.NoError(t, err)
+		assert.False(t, isNew, "active cycle must not be restarted")
+	}
+	complete("act_1")
+
+	enr, isNew, err := api.Enrol(ctx, "weekly", ac)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, 1, enr.Iteration)
+	assert.Equal(t, enforcer.StatusActive, enr.Status)
+
+	for _, id := range []string{"cooldown", "once"} {
+		enr, isNew, err = api.Enrol(ctx, id, ac)
+		require.NoError(t, err)
+		assert.False(t, isNew, "campaign '%s' must not be re-enrolled", id)
+		assert.Equal(t, enforcer.StatusCompleted, enr.Status)
+	}
+
+	complete("act_2")
+	enr, isNew, err = api.Enrol(ctx, "weekly", ac)
+	require.NoError(t, err)
+	assert.False(t, isNew, "max cycles must be respected")
+	assert.Equal(t, 1, enr.Iteration)
+
+	current, err := api.ListExistingEnrolments(ctx, ac.ID, []string{enforcer.StatusCompleted}, false)
+	require.NoError(t, err)
+	assert.Len(t, current, 3)
+
+	all, err := api.ListExistingEnrolments(ctx, ac.ID, []string{enforcer.StatusCompleted}, true)
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+
+	camp, err := api.GetCampaign(ctx, "weekly")
+	require.NoError(t, err)
+	assert.Equal(t, 1, camp.CurEnrolments, "cycles must be counted as one enrolment")
+}
+
+func TestAPI_Ingest_AggregatedSteps(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	ac := enforcer.Actor{ID: "actor_1"}
+
+	now := time.Now()
+	_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:      "big_spender",
+		Enabled: true,
+		StartAt: now.Add(-1 * time.Hour),
+		EndAt:   now.Add(1 * time.Hour),
+		Steps: []enforcer.Step{
+			{Rule: "event.type == 'PURCHASE'", Aggregate: enforcer.AggregateCount, Target: 2},
+			{Rule: "event.type == 'PURCHASE'", Aggregate: enforcer.AggregateSum, Field: "amount", Target: 5000},
+		},
+	})
+	require.NoError(t, err)
+
+	_, _, err = api.Enrol(ctx, "big_spender", ac)
+	require.NoError(t, err)
+
+	purchase := func(id string, amount float64) enforcer.IngestResult {
+		t.Helper()
+		res, err := api.Ingest(ctx, false, ac, enforcer.Action{
+			ID:      id,
+			ActorID: ac.ID,
+			Data:    map[string]interface{}{"type": "PURCHASE", "amount": amount},
+		})
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		return res[0]
+	}
+
+	res := purchase("act_1", 1000)
+	assert.Equal(t, enforcer.IngestResult{StepID: 0, ActionID: "act_1", CampaignID: "big_spender", Value: 1, Partial: true}, res)
+
+	res = purchase("act_2", 1000)
+	assert.Equal(t, enforcer.IngestResult{StepID: 0, ActionID: "act_2", CampaignID: "big_spender", Value: 2}, res)
+
+	res = purchase("act_3", 3000)
+	assert.True(t, res.Partial)
+	assert.Equal(t, 1, res.StepID)
+	assert.Equal(t, 3000.0, res.Value)
+
+	enr, err := api.GetEnrolment(ctx, "big_spender", ac)
+	require.NoError(t, err)
+	assert.Equal(t, enforcer.StatusActive, enr.Status)
+	require.Len(t, enr.Progress, 1)
+	assert.Equal(t, 3000.0, enr.Progress[0].Value)
+
+	res = purchase("act_4", 2500)
+	assert.False(t, res.Partial)
+	assert.Equal(t, 5500.0, res.Value)
+
+	enr, err = api.GetEnrolment(ctx, "big_spender", ac)
+	require.NoError(t, err)
+	assert.Equal(t, enforcer.StatusCompleted, enr.Status)
+	assert.Empty(t, enr.Progress)
+	require.Len(t, enr.CompletedSteps, 2)
+	assert.Equal(t, "act_4", enr.CompletedSteps[1].ActionID)
+	assert.Equal(t, 5500.0, enr.CompletedSteps[1].Value)
+}
+
+func TestAPI_Ingest_Rewards(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	ac := enforcer.Actor{ID: "actor_1"}
+
+	first := 0
+	now := time.Now()
+	_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:      "rewarding",
+		Enabled: true,
+		StartAt: now.Add(-1 * time.Hour),
+		EndAt:   now.Add(1 * time.Hour),
+		Steps:   []enforcer.Step{{Rule: "event.type == 'REGISTER'"}, {Rule: "event.type == 'PURCHASE'"}},
+		Rewards: []enforcer.Reward{
+			{Type: enforcer.RewardPoints, Points: 50, Step: &first},
+			{Type: enforcer.RewardCoupon, Coupon: "WELCOME10"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, _, err = api.Enrol(ctx, "rewarding", ac)
+	require.NoError(t, err)
+
+	res, err := api.Ingest(ctx, false, ac, enforcer.Action{
+		ID:      "act_1",
+		ActorID: ac.ID,
+		Data:    map[string]interface{}{"type": "REGISTER"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Len(t, res[0].Rewards, 1)
+	assert.Equal(t, int64(50), res[0].Rewards[0].Points)
+
+	res, err = api.Ingest(ctx, false, ac, enforcer.Action{
+		ID:      "act_2",
+		ActorID: ac.ID,
+		Data:    map[string]interface{}{"type": "PURCHASE"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Len(t, res[0].Rewards, 1)
+	assert.Equal(t, "WELCOME10", res[0].Rewards[0].Coupon)
+
+	enr, err := api.GetEnrolment(ctx, "rewarding", ac)
+	require.NoError(t, err)
+	assert.Equal(t, enforcer.StatusCompleted, enr.Status)
+	require.Len(t, enr.Rewards, 2)
+	assert.Equal(t, "act_1", enr.Rewards[0].ActionID)
+	assert.Equal(t, enforcer.RewardPoints, enr.Rewards[0].Type)
+	assert.Equal(t, "act_2", enr.Rewards[1].ActionID)
+	assert.Equal(t, enforcer.RewardCoupon, enr.Rewards[1].Type)
+}
+
+func drainTypes(t *testing.T, store enforcer.Outbox) []string {
+	t.Helper()
+
+	pub := &publisher.Memory{}
+	relay := &enforcer.Relay{Outbox: store, Publisher: pub}
+	for {
+		n, err := relay.Drain(context.Background())
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+
+	var res []string
+	for _, evt := range pub.Events() {
+		res = append(res, evt.Type)
+	}
+	return res
+}
+
+func TestAPI_RecordEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &inmem.Store{}
+	api := &enforcer.API{Store: store, Engine: rule.New(), RecordEvents: true}
+	ac := enforcer.Actor{ID: "actor_1"}
+
+	now := time.Now()
+	for _, id := range []string{"onboarding", "expiring"} {
+		_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+			ID:      id,
+			Enabled: true,
+			StartAt: now.Add(-1 * time.Hour),
+			EndAt:   now.Add(1 * time.Hour),
+			Steps:   []enforcer.Step{{Rule: "event.type == 'REGISTER'"}, {Rule: "event.type == 'PURCHASE'"}},
+		})
+		require.NoError(t, err)
+	}
+
+	_, _, err := api.Enrol(ctx, "onboarding", ac)
+	require.NoError(t, err)
+	assert.Equal(t, []string{enforcer.EventEnrolled}, drainTypes(t, store))
+
+	_, _, err = api.Enrol(ctx, "onboarding", ac)
+	require.NoError(t, err)
+	assert.Empty(t, drainTypes(t, store), "existing enrolment must not generate events")
+
+	expiring := enforcer.Enrolment{
+		ActorID:    ac.ID,
+		CampaignID: "expiring",
+		StartedAt:  now.Add(-2 * time.Hour),
+		EndsAt:     now.Add(-1 * time.Minute),
+		TotalSteps: 2,
+	}
+	require.NoError(t, store.UpsertEnrolment(ctx, expiring))
+
+	for i, typ := range []string{"REGISTER", "PURCHASE"} {
+		_, err := api.Ingest(ctx, false, ac, enforcer.Action{
+			ID:      fmt.Sprintf("act_%d", i),
+			ActorID: ac.ID,
+			Data:    map[string]interface{}{"type": typ},
+		})
+		require.NoError(t, err)
+	}
+
+	events, err := store.PendingEvents(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, enforcer.EventExpired, events[0].Type)
+	assert.Equal(t, "expiring", events[0].CampaignID)
+	assert.Equal(t, enforcer.EventStepCompleted, events[1].Type)
+	assert.Equal(t, "act_0", events[1].ActionID)
+	require.NotNil(t, events[1].StepID)
+	assert.Equal(t, 0, *events[1].StepID)
+	assert.Equal(t, enforcer.EventStepCompleted, events[2].Type)
+	assert.Equal(t, enforcer.EventCampaignCompleted, events[3].Type)
+	assert.Equal(t, enforcer.StatusCompleted, events[3].Enrolment.Status)
+	assert.NotEqual(t, events[1].ID, events[2].ID)
+
+	assert.Len(t, drainTypes(t, store), 4)
+	assert.Empty(t, drainTypes(t, store), "acknowledged events must not be published again")
+}
+
+func TestAPI_RecordEvents_Disabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &inmem.Store{}
+	api := &enforcer.API{Store: store, Engine: rule.New()}
+
+	_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:      "onboarding",
+		Enabled: true,
+		StartAt: time.Now().Add(-1 * time.Hour),
+		EndAt:   time.Now().Add(1 * time.Hour),
+		Steps:   []enforcer.Step{{Rule: "true"}},
+	})
+	require.NoError(t, err)
+
+	_, _, err = api.Enrol(ctx, "onboarding", enforcer.Actor{ID: "actor_1"})
+	require.NoError(t, err)
+	assert.Empty(t, drainTypes(t, store))
+}
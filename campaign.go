@@ -11,9 +11,11 @@ import (
 // one-by-one.
 type Campaign struct {
 	ID            string    `json:"id"`
+	Version       int       `json:"version"`
 	Tags          []string  `json:"tags"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
+	UpdatedBy     string    `json:"updated_by,omitempty"`
 	Enabled       bool      `json:"enabled"`
 	StartAt       time.Time `json:"start_at"`
 	EndAt         time.Time `json:"end_at"`
@@ -21,26 +23,53 @@ type Campaign struct {
 	CurEnrolments int       `json:"cur_enrolments"`
 
 	// campaign configurations.
-	Steps         []string `json:"steps,omitempty"`
-	Deadline      int      `json:"deadline,omitempty"`
-	Priority      int      `json:"priority"`
-	IsUnordered   bool     `json:"is_unordered"`
-	Eligibility   string   `json:"eligibility,omitempty"`
-	MaxEnrolments int      `json:"max_enrolments,omitempty"`
+	Steps         []Step `json:"steps,omitempty"`
+	Deadline      int    `json:"deadline,omitempty"`
+	Priority      int    `json:"priority"`
+	IsUnordered   bool   `json:"is_unordered"`
+	Eligibility   string `json:"eligibility,omitempty"`
+	MaxEnrolments int    `json:"max_enrolments,omitempty"`
+	AutoEnrol     bool   `json:"auto_enrol,omitempty"`
+
+	// Recurrence makes the campaign repeatable if set.
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+
+	// Rewards are granted to actors on completion of the campaign (or
+	// of the steps).
+	Rewards []Reward `json:"rewards,omitempty"`
+}
+
+// Recurrence represents the policy for re-enrolling into a campaign after
+// an enrolment is completed or expired. Each re-enrolment starts a new cycle
+// with an incremented Enrolment.Iteration.
+type Recurrence struct {
+	// Cooldown is the number of days to wait after the end of a cycle
+	// before the actor can enrol again.
+	Cooldown int `json:"cooldown,omitempty"`
+
+	// MaxCycles limits the number of cycles an actor can go through. Zero
+	// means no limit.
+	MaxCycles int `json:"max_cycles,omitempty"`
 }
 
-// Updates represents updates that can be applied on a campaign.
+// Updates represents updates that can be applied on a campaign. If Version
+// is set, updates are applied only if it is the current version of the
+// campaign.
 type Updates struct {
-	Tags          []string   `json:"tags,omitempty"`
-	StartAt       *time.Time `json:"start_at,omitempty"`
-	EndAt         *time.Time `json:"end_at,omitempty"`
-	Enabled       *bool      `json:"enabled,omitempty"`
-	Steps         []string   `json:"steps,omitempty"`
-	Deadline      *int       `json:"deadline,omitempty"`
-	Priority      *int       `json:"priority"`
-	IsUnordered   *bool      `json:"is_unordered"`
-	Eligibility   string     `json:"eligibility,omitempty"`
-	MaxEnrolments *int       `json:"max_enrolments,omitempty"`
+	Version       int         `json:"version,omitempty"`
+	Tags          []string    `json:"tags,omitempty"`
+	StartAt       *time.Time  `json:"start_at,omitempty"`
+	EndAt         *time.Time  `json:"end_at,omitempty"`
+	Enabled       *bool       `json:"enabled,omitempty"`
+	Steps         []Step      `json:"steps,omitempty"`
+	Deadline      *int        `json:"deadline,omitempty"`
+	Priority      *int        `json:"priority"`
+	IsUnordered   *bool       `json:"is_unordered"`
+	Eligibility   *string     `json:"eligibility,omitempty"`
+	MaxEnrolments *int        `json:"max_enrolments,omitempty"`
+	AutoEnrol     *bool       `json:"auto_enrol,omitempty"`
+	Recurrence    *Recurrence `json:"recurrence,omitempty"`
+	Rewards       []Reward    `json:"rewards,omitempty"`
 }
 
 // IsActive returns true if the campaign is active relative to the given
@@ -65,6 +94,25 @@ func (c Campaign) HasTags(tags []string) bool {
 	return true
 }
 
+// canReEnrol returns nil if an actor with the given enrolment as the latest
+// cycle can start a new cycle at the given time.
+func (c Campaign) canReEnrol(last Enrolment, at time.Time) error {
+	last.setStatus()
+	if c.Recurrence == nil {
+		return ErrConflict.WithMsgf("campaign '%s' is not repeatable", c.ID)
+	} else if last.Status != StatusCompleted && last.Status != StatusExpired {
+		return ErrConflict.WithMsgf("current cycle of campaign '%s' is not over", c.ID)
+	} else if c.Recurrence.MaxCycles > 0 && last.Iteration+1 >= c.Recurrence.MaxCycles {
+		return ErrConflict.WithMsgf("campaign '%s' allows only %d cycles", c.ID, c.Recurrence.MaxCycles)
+	}
+
+	endedAt := last.endedAt()
+	if nextAt := endedAt.AddDate(0, 0, c.Recurrence.Cooldown); at.Before(nextAt) {
+		return ErrConflict.WithMsgf("campaign '%s' can be enrolled again after %s", c.ID, nextAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
 // Validate performs validation of the entire campaign object. If checkSpec
 // is true, spec is also validated.
 func (c *Campaign) Validate() error {
@@ -104,9 +152,8 @@ func (c *Campaign) Validate() error {
 	}
 
 	for i := range c.Steps {
-		c.Steps[i] = strings.TrimSpace(c.Steps[i])
-		if c.Steps[i] == "" {
-			return ErrInvalid.WithMsgf("step rule %d must not be empty", i)
+		if err := c.Steps[i].validate(i); err != nil {
+			return err
 		}
 	}
 
@@ -118,10 +165,28 @@ func (c *Campaign) Validate() error {
 		return ErrInvalid.WithMsgf("priority must be in range [0, 100]")
 	}
 
+	for i := range c.Rewards {
+		if err := c.Rewards[i].validate(i, len(c.Steps)); err != nil {
+			return err
+		}
+	}
+
+	if c.Recurrence != nil {
+		if c.Recurrence.Cooldown < 0 {
+			return ErrInvalid.WithMsgf("recurrence cooldown must be 0 or positive")
+		} else if c.Recurrence.MaxCycles < 0 {
+			return ErrInvalid.WithMsgf("recurrence max_cycles must be 0 or positive")
+		}
+	}
+
 	return nil
 }
 
-func (c *Campaign) apply(updates Updates) error {
+// apply applies the updates on the campaign. Some fields cannot be updated
+// while the campaign has active enrolments. Steps can be updated if pinned
+// is true (i.e., existing enrolments continue with the steps of the version
+// they started on).
+func (c *Campaign) apply(updates Updates, pinned bool) error {
 	isUsed := c.IsActive(time.Now()) && c.CurEnrolments > 0
 	activeEnrErr := ErrInvalid.WithCausef("%d active enrolments", c.CurEnrolments)
 
@@ -177,9 +242,18 @@ func (c *Campaign) apply(updates Updates) error {
 	if updates.IsUnordered != nil {
 		c.IsUnordered = *updates.IsUnordered
 	}
+	if updates.AutoEnrol != nil {
+		c.AutoEnrol = *updates.AutoEnrol
+	}
+	if updates.Recurrence != nil {
+		c.Recurrence = updates.Recurrence
+	}
 	if updates.Priority != nil {
 		c.Priority = *updates.Priority
 	}
+	if len(updates.Rewards) != 0 {
+		c.Rewards = updates.Rewards
+	}
 
 	if updates.Deadline != nil {
 		if isUsed {
@@ -188,15 +262,15 @@ func (c *Campaign) apply(updates Updates) error {
 		c.Deadline = *updates.Deadline
 	}
 
-	if c.Eligibility != "" {
+	if updates.Eligibility != nil {
 		if isUsed {
 			return activeEnrErr.WithMsgf("eligibility rule cannot be edited")
 		}
-		c.Eligibility = updates.Eligibility
+		c.Eligibility = *updates.Eligibility
 	}
 
 	if len(updates.Steps) != 0 {
-		if isUsed {
+		if isUsed && !pinned {
 			return activeEnrErr.WithMsgf("steps cannot be edited")
 		}
 		c.Steps = updates.Steps
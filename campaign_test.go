@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCampaign_IsActive(t *testing.T) {
@@ -106,7 +107,7 @@ func TestCampaign_Validate(t *testing.T) {
 				Enabled:     false,
 				StartAt:     now.AddDate(0, 0, -3),
 				EndAt:       now.AddDate(0, 0, 3),
-				Steps:       []string{"       "},
+				Steps:       []Step{{Rule: "       "}},
 			},
 			wantErr: ErrInvalid,
 		},
@@ -163,5 +164,37 @@ func TestCampaign_Validate(t *testing.T) {
 }
 
 func TestCampaign_merge(t *testing.T) {
-	// TODO: add tests once apply() is finished.
+	t.Parallel()
+
+	now := time.Now()
+	base := Campaign{
+		ID:          "foo",
+		StartAt:     now.AddDate(0, 0, 1),
+		EndAt:       now.AddDate(0, 0, 3),
+		Eligibility: "not user.blocked",
+	}
+
+	priority := 1
+	empty, rule := "", "user.tier == 'gold'"
+
+	table := []struct {
+		title   string
+		updates Updates
+		want    string
+	}{
+		{title: "Unchanged", updates: Updates{Priority: &priority}, want: "not user.blocked"},
+		{title: "Changed", updates: Updates{Eligibility: &rule}, want: rule},
+		{title: "Cleared", updates: Updates{Eligibility: &empty, Steps: []Step{{Rule: "event.type == 'PURCHASE'"}}}, want: ""},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			t.Parallel()
+
+			c := base
+			require.NoError(t, c.apply(tt.updates, false))
+			assert.Equal(t, tt.want, c.Eligibility)
+		})
+	}
 }
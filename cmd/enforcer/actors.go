@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/resolver"
+)
+
+// actorFlags configures the actor resolution for the commands.
+type actorFlags struct {
+	spec      string
+	timeout   time.Duration
+	cacheTTL  time.Duration
+	cacheSize int
+}
+
+func (af *actorFlags) register(flags *pflag.FlagSet) {
+	flags.StringVar(&af.spec, "actors", "none", "Actor resolver (none, body, file://<json-or-yaml-file> or http(s)://<profile-service>/{id})")
+	flags.DurationVar(&af.timeout, "actors-timeout", 5*time.Second, "Timeout for fetching an actor from the profile service")
+	flags.DurationVar(&af.cacheTTL, "actors-cache-ttl", 0, "Duration to cache actors for (disabled if 0)")
+	flags.IntVar(&af.cacheSize, "actors-cache-size", 10000, "Maximum number of actors to cache")
+}
+
+func (af *actorFlags) resolver() (enforcer.ActorResolver, error) {
+	spec := strings.TrimSpace(af.spec)
+
+	var actors enforcer.ActorResolver
+	switch {
+	case spec == "none":
+		return resolver.None{}, nil
+
+	case spec == "body":
+		log.Warn().Msg("actor attributes are supplied by the clients, eligibility rules can be bypassed by untrusted clients")
+		return resolver.Supplied{}, nil
+
+	case strings.HasPrefix(spec, "file://"):
+		static, err := resolver.LoadFile(strings.TrimPrefix(spec, "file://"))
+		if err != nil {
+			return nil, err
+		}
+		return static, nil
+
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		actors = resolver.NewHTTP(spec, af.timeout)
+
+	default:
+		return nil, fmt.Errorf("unknown actor resolver: '%s'", spec)
+	}
+
+	if af.cacheTTL > 0 {
+		actors = &resolver.Cached{Resolver: actors, TTL: af.cacheTTL, MaxSize: af.cacheSize, Timeout: af.timeout}
+	}
+	return actors, nil
+}
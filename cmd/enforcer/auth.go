@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/spy16/enforcer/httpapi"
+)
+
+// authFlags configures the authentication of the API requests.
+type authFlags struct {
+	apiKeys    []string
+	hmacSecret string
+	rsaKeyFile string
+	issuer     string
+	audience   string
+	allowNoExp bool
+}
+
+func (af *authFlags) register(flags *pflag.FlagSet) {
+	flags.StringArrayVar(&af.apiKeys, "api-key", nil, "API key with the scopes granted (and the actor it is bound to) as <key>=<scope>[,<scope>][@<actor>] (repeatable)")
+	flags.StringVar(&af.hmacSecret, "jwt-secret", "", "Secret for verifying HS256 tokens")
+	flags.StringVar(&af.rsaKeyFile, "jwt-public-key", "", "PEM file with the RSA public key for verifying RS256 tokens")
+	flags.StringVar(&af.issuer, "jwt-issuer", "", "Required issuer ('iss' claim) of the tokens")
+	flags.StringVar(&af.audience, "jwt-audience", "", "Required audience ('aud' claim) of the tokens")
+	flags.BoolVar(&af.allowNoExp, "jwt-allow-no-exp", false, "Accept tokens without expiry ('exp' claim), which never expire")
+}
+
+// auth returns the auth config or nil if no credentials are configured.
+func (af *authFlags) auth() (*httpapi.Auth, error) {
+	if len(af.apiKeys) == 0 && af.hmacSecret == "" && af.rsaKeyFile == "" {
+		return nil, nil
+	}
+
+	auth := &httpapi.Auth{
+		APIKeys:       map[string][]string{},
+		KeyActors:     map[string]string{},
+		Issuer:        af.issuer,
+		Audience:      af.audience,
+		AllowNoExpiry: af.allowNoExp,
+	}
+
+	for _, spec := range af.apiKeys {
+		key, scopes, actor := spec, "", ""
+		if idx := strings.LastIndex(spec, "="); idx >= 0 {
+			key, scopes = spec[:idx], spec[idx+1:]
+		}
+		if idx := strings.Index(scopes, "@"); idx >= 0 {
+			scopes, actor = scopes[:idx], scopes[idx+1:]
+			if actor == "" {
+				return nil, fmt.Errorf("actor of the api key must not be empty")
+			}
+			auth.KeyActors[key] = actor
+		}
+		if key == "" || scopes == "" {
+			return nil, fmt.Errorf("api key must be of the form <key>=<scope>[,<scope>][@<actor>]")
+		}
+		auth.APIKeys[key] = strings.Split(scopes, ",")
+	}
+
+	if af.hmacSecret != "" {
+		auth.HMACSecret = []byte(af.hmacSecret)
+	}
+
+	if af.rsaKeyFile != "" {
+		key, err := readRSAPublicKey(af.rsaKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.RSAPublicKey = key
+	}
+
+	return auth, nil
+}
+
+func readRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in '%s'", path)
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key in '%s' is not an RSA public key", path)
+	}
+	return rsaKey, nil
+}
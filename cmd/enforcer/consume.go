@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/consumer"
+	"github.com/spy16/enforcer/consumer/kafka"
+	"github.com/spy16/enforcer/consumer/nats"
+	"github.com/spy16/enforcer/rule"
+)
+
+func cmdConsume(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "consume",
+		Short: "Ingest actions consumed from a message queue",
+		Long: `Consume subscribes to a Kafka topic or a NATS JetStream subject and
+ingests the actions (JSON encoded) received. Messages are committed only
+after the action is ingested.`,
+	}
+
+	var db, source, policy, deadLetter string
+	var workers int
+	var multi, recordEvents bool
+	var af actorFlags
+	af.register(cmd.Flags())
+	cmd.Flags().StringVarP(&db, "db", "d", ":memory:", "Storage layer URI (:memory:, postgres://..., sqlite://<file> or bolt://<file>)")
+	cmd.Flags().StringVarP(&source, "source", "s", "", "Source URI (kafka://<brokers>/<topic>?group=<group> or nats://<host>/<subject>?durable=<name>)")
+	cmd.Flags().StringVar(&policy, "poison", consumer.PolicyStop, "Poison-message policy (stop, skip or dead-letter)")
+	cmd.Flags().StringVar(&deadLetter, "dead-letter", "", "Topic (or subject) to forward poison messages to")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 8, "Number of actions to ingest concurrently")
+	cmd.Flags().BoolVar(&multi, "multi", false, "Allow an action to complete multiple steps")
+	cmd.Flags().BoolVar(&recordEvents, "record-events", false, "Record lifecycle events in the outbox for the server to publish")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		actors, err := af.resolver()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to setup actor resolver")
+			return
+		}
+
+		src, err := setupSource(source, deadLetter)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to setup source")
+			return
+		}
+		defer func() { _ = src.Close() }()
+
+		store, err := setupStore(ctx, db)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to setup storage")
+			return
+		}
+		if closer, ok := store.(io.Closer); ok {
+			defer func() { _ = closer.Close() }()
+		}
+
+		c := &consumer.Consumer{
+			Source: src,
+			API: &enforcer.API{
+				Store:        store,
+				Engine:       rule.New(),
+				RecordEvents: recordEvents,
+			},
+			Actors:  actors,
+			Workers: workers,
+			Multi:   multi,
+			Policy:  policy,
+			OnError: func(msg consumer.Message, err error) {
+				log.Warn().Err(err).Str("message_id", msg.ID).Msg("failed to consume message")
+			},
+		}
+
+		log.Info().Str("source", source).Msg("starting consumer")
+		if err := c.Run(ctx); err != nil {
+			log.Error().Err(err).Msg("consumer exited with error")
+		}
+	}
+
+	return cmd
+}
+
+type closableSource interface {
+	consumer.Source
+	io.Closer
+}
+
+func setupSource(spec, deadLetter string) (closableSource, error) {
+	uri, err := url.Parse(strings.TrimSpace(spec))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse source URI: '%s'", err, spec)
+	}
+	name := strings.Trim(uri.Path, "/")
+
+	switch uri.Scheme {
+	case "kafka":
+		return kafka.New(kafka.Config{
+			Brokers:         strings.Split(uri.Host, ","),
+			Topic:           name,
+			GroupID:         uri.Query().Get("group"),
+			DeadLetterTopic: deadLetter,
+		})
+
+	case "nats":
+		return nats.New(nats.Config{
+			URL:               (&url.URL{Scheme: uri.Scheme, User: uri.User, Host: uri.Host}).String(),
+			Subject:           name,
+			Durable:           uri.Query().Get("durable"),
+			DeadLetterSubject: deadLetter,
+		})
+
+	default:
+		return nil, fmt.Errorf("unknown source scheme: '%s'", uri.Scheme)
+	}
+}
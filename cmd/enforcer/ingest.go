@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/ingest"
+	"github.com/spy16/enforcer/rule"
+)
+
+const maxLineSize = 1024 * 1024
+
+func cmdIngest(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ingest [file]",
+		Short: "Ingest actions from a JSONL file (or stdin)",
+		Long: `Ingest reads actions (one JSON object per line with 'id', 'actor_id',
+'time' and 'data') from the file (or stdin if the file is '-' or not given)
+and ingests them. Actions of an actor are ingested in the order they appear.`,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	var db string
+	var workers int
+	var multi, recordEvents bool
+	var af actorFlags
+	af.register(cmd.Flags())
+	cmd.Flags().StringVarP(&db, "db", "d", "", "Storage layer URI (postgres://..., sqlite://<file> or bolt://<file>)")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 8, "Number of actions to ingest concurrently")
+	cmd.Flags().BoolVar(&multi, "multi", false, "Allow an action to complete multiple steps")
+	cmd.Flags().BoolVar(&recordEvents, "record-events", false, "Record lifecycle events in the outbox for the server to publish")
+	// results of ingesting into a store that is not given would be lost.
+	_ = cmd.MarkFlagRequired("db")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		input := "-"
+		if len(args) == 1 {
+			input = args[0]
+		}
+
+		actors, err := af.resolver()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to setup actor resolver")
+			return
+		}
+
+		runner := &ingest.Runner{Actors: actors, Workers: workers, Multi: multi}
+		if err := ingestFile(ctx, cmd.OutOrStdout(), db, input, runner, recordEvents); err != nil {
+			log.Fatal().Err(err).Msg("ingest failed")
+		}
+	}
+
+	return cmd
+}
+
+func ingestFile(ctx context.Context, w io.Writer, db, input string, runner *ingest.Runner, recordEvents bool) error {
+	in := io.Reader(os.Stdin)
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	store, err := setupStore(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to setup storage: %w", err)
+	}
+	if closer, ok := store.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+
+	runner.API = &enforcer.API{
+		Store:        store,
+		Engine:       rule.New(),
+		RecordEvents: recordEvents,
+	}
+
+	var sum summary
+	actions := make(chan enforcer.Action)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(actions)
+		readErr <- readActions(ctx, in, actions, sum.malformed)
+	}()
+
+	start := time.Now()
+	err = runner.Run(ctx, actions, sum.add)
+	if err == nil {
+		// Run returns nil only after the reader is done.
+		err = <-readErr
+	}
+	sum.print(w, time.Since(start))
+
+	if err != nil {
+		return err
+	} else if sum.failed > 0 {
+		return fmt.Errorf("failed to ingest %d action(s)", sum.failed)
+	}
+	return nil
+}
+
+// readActions decodes every line of the input as an action and sends it to
+// the channel. Lines that cannot be decoded are reported to onMalformed.
+func readActions(ctx context.Context, r io.Reader, out chan<- enforcer.Action, onMalformed func(line int, err error)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var act enforcer.Action
+		if err := json.Unmarshal(sc.Bytes(), &act); err != nil {
+			onMalformed(line, err)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- act:
+		}
+	}
+	return sc.Err()
+}
+
+type summary struct {
+	mu        sync.Mutex
+	ingested  int
+	failed    int
+	completed int // steps completed.
+	partial   int // aggregated steps progressed without completing.
+	enrolled  int // auto-enrolments progressed by the action enrolling them.
+}
+
+func (sum *summary) add(res ingest.Result) {
+	sum.mu.Lock()
+	defer sum.mu.Unlock()
+
+	if res.Err != nil {
+		sum.failed++
+		log.Error().Err(res.Err).
+			Str("action_id", res.Action.ID).
+			Str("actor_id", res.Action.ActorID).
+			Msg("failed to ingest action")
+		return
+	}
+
+	sum.ingested++
+	for _, r := range res.Results {
+		if r.Partial {
+			sum.partial++
+		} else {
+			sum.completed++
+		}
+		if r.Enrolled {
+			sum.enrolled++
+		}
+	}
+}
+
+func (sum *summary) malformed(line int, err error) {
+	sum.mu.Lock()
+	defer sum.mu.Unlock()
+
+	sum.failed++
+	log.Error().Err(err).Int("line", line).Msg("failed to parse action")
+}
+
+func (sum *summary) print(w io.Writer, took time.Duration) {
+	sum.mu.Lock()
+	defer sum.mu.Unlock()
+
+	_, _ = fmt.Fprintf(w, "ingested: %d\n", sum.ingested)
+	_, _ = fmt.Fprintf(w, "failed: %d\n", sum.failed)
+	_, _ = fmt.Fprintf(w, "steps completed: %d\n", sum.completed)
+	_, _ = fmt.Fprintf(w, "steps partially progressed: %d\n", sum.partial)
+	_, _ = fmt.Fprintf(w, "new auto-enrolments progressed: %d\n", sum.enrolled)
+	_, _ = fmt.Fprintf(w, "took: %s\n", took.Round(time.Millisecond))
+}
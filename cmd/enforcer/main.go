@@ -18,8 +18,12 @@ import (
 
 	"github.com/spy16/enforcer"
 	"github.com/spy16/enforcer/httpapi"
+	"github.com/spy16/enforcer/publisher"
 	"github.com/spy16/enforcer/rule"
+	boltstore "github.com/spy16/enforcer/stores/bolt"
 	"github.com/spy16/enforcer/stores/inmem"
+	sqlstore "github.com/spy16/enforcer/stores/sql"
+	"github.com/spy16/enforcer/webhook"
 )
 
 const versionTpl = `%s
@@ -58,6 +62,8 @@ func main() {
 
 	cli.AddCommand(
 		cmdServe(ctx),
+		cmdIngest(ctx),
+		cmdConsume(ctx),
 	)
 
 	_ = cli.Execute()
@@ -70,24 +76,107 @@ func cmdServe(ctx context.Context) *cobra.Command {
 		Aliases: []string{"server", "start-server", "httpapi"},
 	}
 
-	var addr, db string
+	var addr, db, publish, webhookSecret, webhookDeadLetters string
+	var webhookURLs []string
+	var debug, insecure bool
+	var af actorFlags
+	af.register(cmd.Flags())
+	var auf authFlags
+	auf.register(cmd.Flags())
 	cmd.Flags().StringVarP(&addr, "addr", "a", ":8080", "Bind address for server")
-	cmd.Flags().StringVarP(&db, "db", "d", ":memory:", "Storage layer URI")
+	cmd.Flags().StringVarP(&db, "db", "d", ":memory:", "Storage layer URI (:memory:, postgres://..., sqlite://<file> or bolt://<file>)")
+	cmd.Flags().StringVar(&publish, "publish", "", "Publish lifecycle events as JSON lines (stdout or file://<path>)")
+	cmd.Flags().StringSliceVar(&webhookURLs, "webhook", nil, "URL to deliver enrolment lifecycle events to (repeatable)")
+	cmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Secret for signing webhook payloads")
+	cmd.Flags().StringVar(&webhookDeadLetters, "webhook-dead-letters", "", "Directory to persist failed webhook deliveries in (required with --webhook)")
+	cmd.Flags().BoolVar(&debug, "debug", false, "Include causes of internal errors in responses")
+	cmd.Flags().BoolVar(&insecure, "insecure", false, "Serve without authentication if no api keys or jwt keys are configured")
 
 	cmd.Run = func(cmd *cobra.Command, args []string) {
-		store, err := setupStore(db)
+		actors, err := af.resolver()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to setup actor resolver")
+			return
+		}
+
+		auth, err := auf.auth()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to setup auth")
+			return
+		} else if auth == nil && !insecure {
+			log.Fatal().Msg("no api keys or jwt keys configured, use --insecure to serve without authentication")
+			return
+		} else if auth == nil {
+			log.Warn().Msg("serving without authentication since --insecure is set")
+		}
+
+		store, err := setupStore(ctx, db)
 		if err != nil {
 			log.Fatal().Err(err).Msg("failed to setup storage")
 			return
 		}
+		if closer, ok := store.(io.Closer); ok {
+			defer func() { _ = closer.Close() }()
+		}
 
 		enforcerAPI := &enforcer.API{
 			Store:  store,
 			Engine: rule.New(),
 		}
 
+		var publishers []enforcer.Publisher
+		if publish != "" {
+			pub, closer, err := setupPublisher(publish)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to setup publisher")
+				return
+			}
+			if closer != nil {
+				defer func() { _ = closer.Close() }()
+			}
+			publishers = append(publishers, pub)
+		}
+
+		var hooks *webhook.Dispatcher
+		if len(webhookURLs) > 0 {
+			if webhookDeadLetters == "" {
+				// without dead letters, an endpoint that is down would stall
+				// the outbox for all the publishers.
+				log.Fatal().Msg("--webhook-dead-letters is required with --webhook")
+				return
+			}
+
+			var endpoints []webhook.Endpoint
+			for _, u := range webhookURLs {
+				endpoints = append(endpoints, webhook.Endpoint{URL: u, Secret: webhookSecret})
+			}
+			hooks = webhook.New(webhook.Config{
+				Endpoints:   endpoints,
+				DeadLetters: &webhook.DirStore{Path: webhookDeadLetters},
+			})
+			publishers = append(publishers, hooks)
+			go func() { _ = hooks.Run(ctx) }()
+		}
+
+		if len(publishers) > 0 {
+			enforcerAPI.RecordEvents = true
+			relay := &enforcer.Relay{
+				Outbox:    store,
+				Publisher: publisher.Multi(publishers...),
+				OnError: func(err error) {
+					log.Warn().Err(err).Msg("failed to relay events from outbox")
+				},
+			}
+			go func() { _ = relay.Run(ctx) }()
+		}
+
 		log.Info().Str("addr", addr).Msg("starting http-api server")
-		if err := httpapi.Serve(ctx, addr, enforcerAPI, getActor); err != nil {
+		if hooks != nil {
+			err = httpapi.Serve(ctx, addr, enforcerAPI, actors, hooks, auth, debug)
+		} else {
+			err = httpapi.Serve(ctx, addr, enforcerAPI, actors, nil, auth, debug)
+		}
+		if err != nil {
 			log.Fatal().Err(err).Msg("server exited with error")
 		}
 	}
@@ -95,16 +184,6 @@ func cmdServe(ctx context.Context) *cobra.Command {
 	return cmd
 }
 
-func getActor(_ context.Context, actorID string) (*enforcer.Actor, error) {
-	return &enforcer.Actor{
-		ID: actorID,
-		Attribs: map[string]interface{}{
-			"is_blacklisted": false,
-			"segments":       []string{"foo", "gbm-foo"},
-		},
-	}, nil
-}
-
 func setupLogger(level, format string) (destroy func()) {
 	const (
 		bufSz    = 1000
@@ -133,7 +212,23 @@ func setupLogger(level, format string) (destroy func()) {
 	}
 }
 
-func setupStore(spec string) (enforcer.Store, error) {
+func setupPublisher(spec string) (enforcer.Publisher, io.Closer, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "stdout" {
+		return publisher.NewJSONL(os.Stdout), nil, nil
+	}
+
+	if !strings.HasPrefix(spec, "file://") {
+		return nil, nil, fmt.Errorf("unknown publisher: '%s'", spec)
+	}
+	f, err := os.OpenFile(strings.TrimPrefix(spec, "file://"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publisher.NewJSONL(f), f, nil
+}
+
+func setupStore(ctx context.Context, spec string) (enforcer.Store, error) {
 	spec = strings.TrimSpace(spec)
 	if spec == ":memory:" {
 		return &inmem.Store{}, nil
@@ -143,6 +238,18 @@ func setupStore(spec string) (enforcer.Store, error) {
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed to parse storage URI: '%s'", err, spec)
 	}
-	// TODO: add storage layer init based on the parsed URI.
-	return nil, fmt.Errorf("unknown storage scheme: '%s'", uri.Scheme)
+
+	switch uri.Scheme {
+	case "postgres", "postgresql":
+		return sqlstore.Open(ctx, sqlstore.Postgres, spec)
+
+	case "sqlite":
+		return sqlstore.Open(ctx, sqlstore.SQLite, strings.TrimPrefix(spec, "sqlite://"))
+
+	case "bolt":
+		return boltstore.Open(strings.TrimPrefix(spec, "bolt://"))
+
+	default:
+		return nil, fmt.Errorf("unknown storage scheme: '%s'", uri.Scheme)
+	}
 }
@@ -0,0 +1,301 @@
+// Package consumer provides ingestion of actions from message queues. See
+// the kafka and nats packages for the Source implementations.
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/ingest"
+)
+
+// Poison-message policies. A message is poison if it cannot be decoded as
+// an action or if ingesting it fails with a non-retryable error (e.g., the
+// action is invalid). If all attempts to ingest a message fail with a
+// retryable error (e.g., the store is down), the consumer stops without
+// committing the message irrespective of the policy.
+const (
+	// PolicyStop stops the consumer without committing the message, so the
+	// message is redelivered once the consumer is restarted.
+	PolicyStop = "stop"
+
+	// PolicySkip commits the message and moves on.
+	PolicySkip = "skip"
+
+	// PolicyDeadLetter forwards the message to the dead-letter destination
+	// of the source and commits it. Source must implement DeadLetterer.
+	PolicyDeadLetter = "dead-letter"
+)
+
+// Source implementation provides messages from a message queue.
+type Source interface {
+	// Fetch blocks until the next message is available. io.EOF must be
+	// returned if the source is exhausted.
+	Fetch(ctx context.Context) (Message, error)
+
+	// Commit acknowledges the message as processed. Messages may be
+	// committed in an order different from the one they were fetched in,
+	// but a message must not be considered committed (e.g., an offset must
+	// not be committed) until all the messages before it are.
+	Commit(ctx context.Context, msg Message) error
+}
+
+// DeadLetterer is an optional capability of a Source to forward poison
+// messages to a dead-letter destination (e.g., a topic).
+type DeadLetterer interface {
+	DeadLetter(ctx context.Context, msg Message, reason error) error
+}
+
+// Message represents a message received from a Source. Value must be a JSON
+// encoded enforcer.Action. Key (if set) is used as the actor ID of actions
+// without one.
+type Message struct {
+	ID    string
+	Key   string
+	Value []byte
+
+	// Raw is the message specific to the source.
+	Raw interface{}
+}
+
+// Consumer ingests the actions received from the source. Actions of an
+// actor are always ingested in the order received and a message is
+// committed only after the action is ingested (or is handled as per the
+// poison-message policy).
+type Consumer struct {
+	Source  Source
+	API     ingest.Ingester
+	Actors  enforcer.ActorResolver
+	Workers int  // default: 8
+	Multi   bool // complete multiple steps with a single action.
+
+	// Policy for poison messages (default: PolicyStop).
+	Policy string
+
+	// MaxAttempts is the number of times ingesting an action is attempted
+	// when it fails with a retryable error (default: 3).
+	MaxAttempts int
+
+	// Backoff is the time to wait before the first retry and is doubled
+	// for every retry after that (default: 1s).
+	Backoff time.Duration
+
+	// OnError (if set) is invoked (concurrently) for every poison message
+	// and for every failure to commit.
+	OnError func(msg Message, err error)
+}
+
+// Run consumes the source until the context is cancelled, the source is
+// exhausted, a poison message is received with PolicyStop or all attempts
+// to ingest a message fail with a retryable error.
+func (c *Consumer) Run(ctx context.Context) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stopOnce sync.Once
+	var stopErr error
+	stop := func(err error) {
+		stopOnce.Do(func() {
+			stopErr = err
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	queues := make([]chan job, c.Workers)
+	for i := range queues {
+		queues[i] = make(chan job, 1)
+
+		wg.Add(1)
+		go func(queue <-chan job) {
+			defer wg.Done()
+			for j := range queue {
+				if err := c.handle(ctx, j); err != nil {
+					stop(err)
+				}
+			}
+		}(queues[i])
+	}
+
+	err := c.dispatch(ctx, queues, stop)
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	if stopErr != nil {
+		return stopErr
+	}
+	return err
+}
+
+func (c *Consumer) init() error {
+	if c.Workers <= 0 {
+		c.Workers = 8
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = 1 * time.Second
+	}
+
+	switch c.Policy {
+	case "":
+		c.Policy = PolicyStop
+
+	case PolicyStop, PolicySkip:
+
+	case PolicyDeadLetter:
+		if _, ok := c.Source.(DeadLetterer); !ok {
+			return enforcer.ErrUnsupported.WithCausef("source does not support dead-lettering")
+		}
+
+	default:
+		return enforcer.ErrInvalid.WithCausef("unknown poison-message policy '%s'", c.Policy)
+	}
+	return nil
+}
+
+// dispatch fetches messages and sends them to the queue of the shard of
+// the actor.
+func (c *Consumer) dispatch(ctx context.Context, queues []chan job, stop func(error)) error {
+	for {
+		msg, err := c.Source.Fetch(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var act enforcer.Action
+		if err := json.Unmarshal(msg.Value, &act); err != nil {
+			err = enforcer.ErrInvalid.WithCausef("failed to decode action: %v", err)
+			if err := c.poison(ctx, msg, err); err != nil {
+				stop(err)
+				return nil
+			}
+			continue
+		}
+		if act.ActorID == "" {
+			act.ActorID = msg.Key
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case queues[ingest.Shard(act.ActorID, len(queues))] <- job{msg: msg, act: act}:
+		}
+	}
+}
+
+// handle ingests the action with retries and commits the message. Returns
+// error only if the consumer must stop.
+func (c *Consumer) handle(ctx context.Context, j job) error {
+	backoff := c.Backoff
+
+	var err error
+	for attempt := 1; attempt <= c.MaxAttempts; attempt++ {
+		if err = c.ingest(ctx, j.act); err == nil || !isRetryable(err) {
+			break
+		}
+
+		if attempt < c.MaxAttempts {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+
+	if ctx.Err() != nil {
+		// consumer is stopping. message is left uncommitted so that it
+		// is redelivered.
+		return nil
+	} else if err != nil && isRetryable(err) {
+		// message is not at fault. it is left uncommitted so that it is
+		// ingested once the consumer is restarted.
+		return fmt.Errorf("failed to ingest message '%s' after %d attempts: %w", j.msg.ID, c.MaxAttempts, err)
+	} else if err != nil {
+		return c.poison(ctx, j.msg, err)
+	}
+
+	c.commit(ctx, j.msg)
+	return nil
+}
+
+func (c *Consumer) ingest(ctx context.Context, act enforcer.Action) error {
+	ac, err := ingest.Resolve(ctx, c.Actors, act.ActorID)
+	if err != nil {
+		return err
+	}
+	act.ActorID = ac.ID
+
+	_, err = c.API.Ingest(ctx, c.Multi, *ac, act)
+	return err
+}
+
+// poison handles the poison message as per the policy. Returns error only
+// if the consumer must stop.
+func (c *Consumer) poison(ctx context.Context, msg Message, reason error) error {
+	if c.OnError != nil {
+		c.OnError(msg, reason)
+	}
+
+	switch c.Policy {
+	case PolicySkip:
+
+	case PolicyDeadLetter:
+		if err := c.Source.(DeadLetterer).DeadLetter(ctx, msg, reason); err != nil {
+			return fmt.Errorf("failed to dead-letter message '%s': %w", msg.ID, err)
+		}
+
+	default:
+		return fmt.Errorf("poison message '%s': %w", msg.ID, reason)
+	}
+
+	c.commit(ctx, msg)
+	return nil
+}
+
+func (c *Consumer) commit(ctx context.Context, msg Message) {
+	if err := c.Source.Commit(ctx, msg); err != nil && c.OnError != nil {
+		c.OnError(msg, fmt.Errorf("failed to commit: %w", err))
+	}
+}
+
+type job struct {
+	msg Message
+	act enforcer.Action
+}
+
+// isRetryable returns false for errors that would occur again if ingesting
+// the same action is retried.
+func isRetryable(err error) bool {
+	nonRetryable := []error{
+		enforcer.ErrInvalid,
+		enforcer.ErrNotFound,
+		enforcer.ErrIneligible,
+		enforcer.ErrUnsupported,
+		enforcer.ErrUnprocessable,
+	}
+	for _, target := range nonRetryable {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,226 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/consumer"
+)
+
+func TestConsumer_Run(t *testing.T) {
+	t.Parallel()
+
+	var msgs []consumer.Message
+	for i := 0; i < 10; i++ {
+		for _, actorID := range []string{"actor_1", "actor_2", "actor_3"} {
+			msgs = append(msgs, message(fmt.Sprintf("%s_%d", actorID, i), actorID,
+				fmt.Sprintf(`{"id": "act_%d", "data": {}}`, i)))
+		}
+	}
+	src := consumer.NewMemory(msgs...)
+	api := &fakeAPI{seen: map[string][]string{}}
+
+	c := &consumer.Consumer{Source: src, API: api, Actors: enforcer.ActorResolverFunc(resolve), Workers: 2}
+	require.NoError(t, c.Run(context.Background()))
+
+	assert.Len(t, src.Committed(), len(msgs))
+	for actorID, ids := range api.seen {
+		require.Len(t, ids, 10)
+		for i, id := range ids {
+			assert.Equalf(t, fmt.Sprintf("act_%d", i), id, "actions of '%s' ingested out of order", actorID)
+		}
+	}
+}
+
+func TestConsumer_Run_Poison(t *testing.T) {
+	t.Parallel()
+
+	msgs := func() []consumer.Message {
+		return []consumer.Message{
+			message("msg_1", "actor_1", `{"id": "act_1"}`),
+			message("msg_2", "actor_1", `not-json`),
+			message("msg_3", "actor_1", `{"id": "invalid"}`),
+			message("msg_4", "unknown", `{"id": "act_4"}`),
+			message("msg_5", "actor_1", `{"id": "act_5"}`),
+		}
+	}
+
+	table := []struct {
+		title        string
+		policy       string
+		wantErr      bool
+		committed    []string
+		deadLettered []string
+	}{
+		{
+			title:     "Skip",
+			policy:    consumer.PolicySkip,
+			committed: []string{"msg_1", "msg_2", "msg_3", "msg_4", "msg_5"},
+		},
+		{
+			title:        "DeadLetter",
+			policy:       consumer.PolicyDeadLetter,
+			committed:    []string{"msg_1", "msg_2", "msg_3", "msg_4", "msg_5"},
+			deadLettered: []string{"msg_2", "msg_3", "msg_4"},
+		},
+		{
+			title:   "Stop",
+			policy:  consumer.PolicyStop,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			t.Parallel()
+
+			src := consumer.NewMemory(msgs()...)
+			var mu sync.Mutex
+			var poisoned []string
+			c := &consumer.Consumer{
+				Source:      src,
+				API:         &fakeAPI{seen: map[string][]string{}},
+				Actors:      enforcer.ActorResolverFunc(resolve),
+				Policy:      tt.policy,
+				MaxAttempts: 2,
+				Backoff:     time.Millisecond,
+				OnError: func(msg consumer.Message, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					poisoned = append(poisoned, msg.ID)
+				},
+			}
+
+			err := c.Run(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.NotContains(t, src.Committed(), "msg_2")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"msg_2", "msg_3", "msg_4"}, sorted(poisoned))
+			assert.Equal(t, tt.committed, sorted(src.Committed()))
+			assert.Equal(t, tt.deadLettered, sorted(src.DeadLettered()))
+		})
+	}
+}
+
+func TestConsumer_Run_Retry(t *testing.T) {
+	t.Parallel()
+
+	src := consumer.NewMemory(message("msg_1", "actor_1", `{"id": "flaky"}`))
+	api := &fakeAPI{seen: map[string][]string{}}
+	c := &consumer.Consumer{Source: src, API: api, Actors: enforcer.ActorResolverFunc(resolve), Backoff: time.Millisecond}
+
+	require.NoError(t, c.Run(context.Background()))
+	assert.Equal(t, []string{"msg_1"}, src.Committed())
+	assert.Equal(t, []string{"flaky", "flaky"}, api.seen["actor_1"])
+}
+
+func TestConsumer_Run_Unavailable(t *testing.T) {
+	t.Parallel()
+
+	table := []struct {
+		title  string
+		msg    consumer.Message
+		actors enforcer.ActorResolverFunc
+	}{
+		{
+			title:  "Store",
+			msg:    message("msg_1", "actor_1", `{"id": "failing"}`),
+			actors: resolve,
+		},
+		{
+			title: "Resolver",
+			msg:   message("msg_1", "actor_1", `{"id": "act_1"}`),
+			actors: func(_ context.Context, actorID string) (*enforcer.Actor, error) {
+				return nil, enforcer.ErrInternal.WithCausef("profile service timed out")
+			},
+		},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			t.Parallel()
+
+			src := consumer.NewMemory(tt.msg)
+			c := &consumer.Consumer{
+				Source:      src,
+				API:         &fakeAPI{seen: map[string][]string{}},
+				Actors:      tt.actors,
+				Policy:      consumer.PolicyDeadLetter,
+				MaxAttempts: 2,
+				Backoff:     time.Millisecond,
+			}
+
+			err := c.Run(context.Background())
+			assert.Error(t, err, "consumer must stop when retries are exhausted")
+			assert.Empty(t, src.Committed())
+			assert.Empty(t, src.DeadLettered())
+		})
+	}
+}
+
+func TestConsumer_Run_InvalidPolicy(t *testing.T) {
+	t.Parallel()
+
+	c := &consumer.Consumer{Source: noDeadLetter{consumer.NewMemory()}, Policy: consumer.PolicyDeadLetter}
+	assert.True(t, errors.Is(c.Run(context.Background()), enforcer.ErrUnsupported))
+
+	c = &consumer.Consumer{Source: consumer.NewMemory(), Policy: "retry-forever"}
+	assert.True(t, errors.Is(c.Run(context.Background()), enforcer.ErrInvalid))
+}
+
+func message(id, key, value string) consumer.Message {
+	return consumer.Message{ID: id, Key: key, Value: []byte(value)}
+}
+
+func resolve(_ context.Context, actorID string) (*enforcer.Actor, error) {
+	if actorID == "unknown" {
+		return nil, enforcer.ErrNotFound
+	}
+	return &enforcer.Actor{ID: actorID}, nil
+}
+
+func sorted(arr []string) []string {
+	sort.Strings(arr)
+	return arr
+}
+
+type noDeadLetter struct{ consumer.Source }
+
+// fakeAPI records the actions ingested. Action 'invalid' fails with a non
+// retryable error, 'failing' always fails and 'flaky' fails once.
+type fakeAPI struct {
+	mu   sync.Mutex
+	seen map[string][]string
+}
+
+func (api *fakeAPI) Ingest(_ context.Context, _ bool, ac enforcer.Actor, act enforcer.Action) ([]enforcer.IngestResult, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.seen[ac.ID] = append(api.seen[ac.ID], act.ID)
+	switch act.ID {
+	case "invalid":
+		return nil, enforcer.ErrInvalid
+	case "failing":
+		return nil, errors.New("store is down")
+	case "flaky":
+		if len(api.seen[ac.ID]) == 1 {
+			return nil, errors.New("store is down")
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,163 @@
+// Package kafka provides a consumer.Source backed by a Kafka consumer group.
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/spy16/enforcer/consumer"
+)
+
+// HeaderError is set on dead-lettered messages to the reason.
+const HeaderError = "x-enforcer-error"
+
+var (
+	_ consumer.Source       = (*Source)(nil)
+	_ consumer.DeadLetterer = (*Source)(nil)
+)
+
+// Config represents the configuration for the Kafka source.
+type Config struct {
+	Brokers []string
+	Topic   string
+	GroupID string
+
+	// DeadLetterTopic (if set) receives the poison messages.
+	DeadLetterTopic string
+}
+
+// New returns a source that reads the topic as a member of the consumer
+// group. Offsets are committed only when all the messages before it in the
+// partition are committed.
+func New(cfg Config) (*Source, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" || cfg.GroupID == "" {
+		return nil, fmt.Errorf("brokers, topic and group are required")
+	}
+
+	src := &Source{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: cfg.Brokers,
+			Topic:   cfg.Topic,
+			GroupID: cfg.GroupID,
+		}),
+		partitions: map[int]*offsetTracker{},
+	}
+
+	if cfg.DeadLetterTopic != "" {
+		src.deadLetter = &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.DeadLetterTopic,
+			RequiredAcks: kafka.RequireAll,
+		}
+	}
+	return src, nil
+}
+
+// Source provides messages from a Kafka topic.
+type Source struct {
+	reader     *kafka.Reader
+	deadLetter *kafka.Writer
+
+	mu         sync.Mutex
+	partitions map[int]*offsetTracker
+}
+
+func (src *Source) Fetch(ctx context.Context) (consumer.Message, error) {
+	m, err := src.reader.FetchMessage(ctx)
+	if err != nil {
+		return consumer.Message{}, err
+	}
+
+	src.mu.Lock()
+	tracker, found := src.partitions[m.Partition]
+	if !found {
+		tracker = &offsetTracker{}
+		src.partitions[m.Partition] = tracker
+	}
+	tracker.add(m.Offset)
+	src.mu.Unlock()
+
+	return consumer.Message{
+		ID:    fmt.Sprintf("%s/%d/%d", m.Topic, m.Partition, m.Offset),
+		Key:   string(m.Key),
+		Value: m.Value,
+		Raw:   m,
+	}, nil
+}
+
+func (src *Source) Commit(ctx context.Context, msg consumer.Message) error {
+	m := msg.Raw.(kafka.Message)
+
+	// lock is held while committing so that commits of a partition are
+	// never re-ordered.
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	upto, ok := src.partitions[m.Partition].complete(m.Offset)
+	if !ok {
+		return nil
+	}
+
+	m.Offset = upto
+	return src.reader.CommitMessages(ctx, m)
+}
+
+func (src *Source) DeadLetter(ctx context.Context, msg consumer.Message, reason error) error {
+	if src.deadLetter == nil {
+		return fmt.Errorf("dead-letter topic is not configured")
+	}
+
+	m := msg.Raw.(kafka.Message)
+	return src.deadLetter.WriteMessages(ctx, kafka.Message{
+		Key:   m.Key,
+		Value: m.Value,
+		Headers: append(m.Headers, kafka.Header{
+			Key:   HeaderError,
+			Value: []byte(reason.Error()),
+		}),
+	})
+}
+
+// Close closes the reader and the dead-letter writer.
+func (src *Source) Close() error {
+	if src.deadLetter != nil {
+		_ = src.deadLetter.Close()
+	}
+	return src.reader.Close()
+}
+
+// offsetTracker tracks the offsets of a partition that are fetched but not
+// committed yet.
+type offsetTracker struct {
+	pending   []int64
+	completed map[int64]bool
+}
+
+func (ot *offsetTracker) add(offset int64) {
+	if n := len(ot.pending); n > 0 && offset <= ot.pending[n-1] {
+		// partition was re-assigned or rewound. messages pending so far
+		// will be fetched again.
+		ot.pending, ot.completed = nil, nil
+	}
+	ot.pending = append(ot.pending, offset)
+}
+
+// complete marks the offset as done and returns the offset up to which all
+// the messages are done, if it advanced.
+func (ot *offsetTracker) complete(offset int64) (int64, bool) {
+	if ot.completed == nil {
+		ot.completed = map[int64]bool{}
+	}
+	ot.completed[offset] = true
+
+	upto, advanced := int64(-1), false
+	for len(ot.pending) > 0 && ot.completed[ot.pending[0]] {
+		upto, advanced = ot.pending[0], true
+		delete(ot.completed, upto)
+		ot.pending = ot.pending[1:]
+	}
+	return upto, advanced
+}
@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	t.Parallel()
+
+	ot := &offsetTracker{}
+	for _, offset := range []int64{10, 11, 12, 13} {
+		ot.add(offset)
+	}
+
+	_, ok := ot.complete(12)
+	assert.False(t, ok, "offset must not advance past pending messages")
+
+	_, ok = ot.complete(11)
+	assert.False(t, ok)
+
+	upto, ok := ot.complete(10)
+	assert.True(t, ok)
+	assert.Equal(t, int64(12), upto)
+
+	upto, ok = ot.complete(13)
+	assert.True(t, ok)
+	assert.Equal(t, int64(13), upto)
+
+	// rewind after a re-balance.
+	ot.add(20)
+	ot.add(5)
+	upto, ok = ot.complete(5)
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), upto)
+}
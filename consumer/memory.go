@@ -0,0 +1,75 @@
+package consumer
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+var (
+	_ Source       = (*Memory)(nil)
+	_ DeadLetterer = (*Memory)(nil)
+)
+
+// NewMemory returns an in-process source with the given messages. It is
+// meant for tests.
+func NewMemory(msgs ...Message) *Memory {
+	return &Memory{pending: msgs}
+}
+
+// Memory is a Source that provides messages from memory and records the
+// committed and dead-lettered messages. Fetch returns io.EOF once all the
+// messages are fetched.
+type Memory struct {
+	mu           sync.Mutex
+	pending      []Message
+	committed    []string
+	deadLettered []string
+}
+
+func (mem *Memory) Fetch(ctx context.Context) (Message, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return Message{}, err
+	} else if len(mem.pending) == 0 {
+		return Message{}, io.EOF
+	}
+
+	msg := mem.pending[0]
+	mem.pending = mem.pending[1:]
+	return msg, nil
+}
+
+func (mem *Memory) Commit(_ context.Context, msg Message) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.committed = append(mem.committed, msg.ID)
+	return nil
+}
+
+func (mem *Memory) DeadLetter(_ context.Context, msg Message, _ error) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.deadLettered = append(mem.deadLettered, msg.ID)
+	return nil
+}
+
+// Committed returns IDs of the committed messages in the order committed.
+func (mem *Memory) Committed() []string {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	return append([]string(nil), mem.committed...)
+}
+
+// DeadLettered returns IDs of the dead-lettered messages.
+func (mem *Memory) DeadLettered() []string {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	return append([]string(nil), mem.deadLettered...)
+}
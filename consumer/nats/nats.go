@@ -0,0 +1,154 @@
+// Package nats provides a consumer.Source backed by a durable NATS JetStream
+// pull consumer.
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/spy16/enforcer/consumer"
+)
+
+// Headers used by the source.
+const (
+	// HeaderKey (if set) is used as the message key (i.e., actor ID of the
+	// actions without one).
+	HeaderKey = "Enforcer-Key"
+
+	// HeaderError is set on dead-lettered messages to the reason.
+	HeaderError = "Enforcer-Error"
+)
+
+var (
+	_ consumer.Source       = (*Source)(nil)
+	_ consumer.DeadLetterer = (*Source)(nil)
+)
+
+// Config represents the configuration for the NATS source.
+type Config struct {
+	URL     string
+	Subject string
+	Durable string
+
+	// AckWait is the time after which the un-acknowledged messages are
+	// redelivered (default: 30s).
+	AckWait time.Duration
+
+	// BatchSize is the number of messages to pull at a time (default: 100).
+	BatchSize int
+
+	// DeadLetterSubject (if set) receives the poison messages. Subject must
+	// be bound to a stream.
+	DeadLetterSubject string
+}
+
+// New connects to the NATS server and returns a source that pulls messages
+// of the subject using the durable consumer. Messages are acknowledged only
+// when committed.
+func New(cfg Config) (*Source, error) {
+	if cfg.URL == "" || cfg.Subject == "" || cfg.Durable == "" {
+		return nil, fmt.Errorf("url, subject and durable are required")
+	}
+	if cfg.AckWait <= 0 {
+		cfg.AckWait = 30 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+
+	nc, err := nats.Connect(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	sub, err := js.PullSubscribe(cfg.Subject, cfg.Durable, nats.ManualAck(), nats.AckWait(cfg.AckWait))
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return &Source{cfg: cfg, nc: nc, js: js, sub: sub}, nil
+}
+
+// Source provides messages from a NATS JetStream subject.
+type Source struct {
+	cfg Config
+	nc  *nats.Conn
+	js  nats.JetStreamContext
+	sub *nats.Subscription
+
+	mu       sync.Mutex
+	buffered []*nats.Msg
+}
+
+func (src *Source) Fetch(ctx context.Context) (consumer.Message, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	for len(src.buffered) == 0 {
+		if err := ctx.Err(); err != nil {
+			return consumer.Message{}, err
+		}
+
+		msgs, err := src.sub.Fetch(src.cfg.BatchSize, nats.Context(ctx))
+		if err != nil {
+			if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+				continue
+			}
+			return consumer.Message{}, err
+		}
+		src.buffered = msgs
+	}
+
+	m := src.buffered[0]
+	src.buffered = src.buffered[1:]
+
+	id := m.Subject
+	if meta, err := m.Metadata(); err == nil {
+		id = fmt.Sprintf("%s/%d", meta.Stream, meta.Sequence.Stream)
+	}
+
+	return consumer.Message{
+		ID:    id,
+		Key:   m.Header.Get(HeaderKey),
+		Value: m.Data,
+		Raw:   m,
+	}, nil
+}
+
+func (src *Source) Commit(ctx context.Context, msg consumer.Message) error {
+	return msg.Raw.(*nats.Msg).AckSync(nats.Context(ctx))
+}
+
+func (src *Source) DeadLetter(ctx context.Context, msg consumer.Message, reason error) error {
+	if src.cfg.DeadLetterSubject == "" {
+		return fmt.Errorf("dead-letter subject is not configured")
+	}
+
+	m := msg.Raw.(*nats.Msg)
+	dl := nats.NewMsg(src.cfg.DeadLetterSubject)
+	dl.Data = m.Data
+	for k, v := range m.Header {
+		dl.Header[k] = v
+	}
+	dl.Header.Set(HeaderError, reason.Error())
+	_, err := src.js.PublishMsg(dl, nats.Context(ctx))
+	return err
+}
+
+// Close drains the subscription and closes the connection.
+func (src *Source) Close() error {
+	defer src.nc.Close()
+	return src.sub.Drain()
+}
@@ -1,6 +1,9 @@
 package enforcer
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -14,26 +17,70 @@ const (
 	StatusCompleted = "COMPLETED"
 )
 
-var val = validator.New()
+var val = newValidator()
 
 // Enrolment represents a binding between an actor & a campaign, and
-// also contains the progress of the actor in the campaign.
+// also contains the progress of the actor in the campaign. For recurring
+// campaigns, every cycle is a separate enrolment identified by Iteration
+// (starting at 0).
 type Enrolment struct {
-	Status         string       `json:"status" validate:"alpha,uppercase"`
-	ActorID        string       `json:"actor_id" validate:"required"`
-	CampaignID     string       `json:"campaign_id" validate:"required"`
+	Status     string `json:"status" validate:"alpha,uppercase"`
+	ActorID    string `json:"actor_id" validate:"required"`
+	CampaignID string `json:"campaign_id" validate:"required"`
+	Iteration  int    `json:"iteration" validate:"gte=0"`
+
+	// Version is incremented on every change of the enrolment. It is used
+	// to detect concurrent changes (see CheckEnrolmentVersion).
+	Version int `json:"version,omitempty"`
+
+	// CampaignVersion is the version of the campaign the enrolment started
+	// on. Steps and rewards of that version apply to the enrolment if the
+	// store keeps revisions (see RevisionStore).
+	CampaignVersion int `json:"campaign_version,omitempty"`
+
 	StartedAt      time.Time    `json:"started_at,omitempty"`
 	EndsAt         time.Time    `json:"ends_at,omitempty"`
 	TotalSteps     int          `json:"total_steps"`
-	CompletedSteps []StepResult `json:"completed_steps,omitempty"`
+	CompletedSteps []StepResult `json:"completed_steps,omitempty" validate:"dive"`
+
+	// Progress contains the partial progress in aggregated steps that
+	// are not completed yet.
+	Progress []StepProgress `json:"progress,omitempty"`
+
+	// Rewards contains the rewards granted so far.
+	Rewards []GrantedReward `json:"rewards,omitempty"`
+
+	// ExpiryNotified is set once the EventExpired is recorded for the
+	// enrolment.
+	ExpiryNotified bool `json:"expiry_notified,omitempty"`
 }
 
 // StepResult represents a campaign step that was completed by an
-// actor.
+// actor. For aggregated steps, ActionID is the action that reached the
+// target and Value is the final aggregate.
 type StepResult struct {
-	StepID   int       `json:"step_id" validate:"lte=0"`
+	StepID   int       `json:"step_id" validate:"gte=0"`
 	DoneAt   time.Time `json:"done_at" validate:"required"`
 	ActionID string    `json:"action_id" validate:"required"`
+	Value    float64   `json:"value,omitempty"`
+}
+
+// CheckEnrolmentVersion returns ErrConflict if the enrolment is not the next
+// version of the stored one (nil if not stored yet), i.e., the stored
+// enrolment has been changed since the enrolment was read. Stores use it in
+// IngestLog.CommitIngested.
+func CheckEnrolmentVersion(stored *Enrolment, enr Enrolment) error {
+	cur := 0
+	if stored != nil {
+		cur = stored.Version
+	}
+
+	if enr.Version != cur+1 {
+		return ErrConflict.
+			WithMsgf("enrolment of actor '%s' into campaign '%s' has been modified", enr.ActorID, enr.CampaignID).
+			WithCausef("version %d does not follow the current version %d", enr.Version, cur)
+	}
+	return nil
 }
 
 func (enr *Enrolment) setStatus() {
@@ -48,6 +95,42 @@ func (enr *Enrolment) setStatus() {
 	}
 }
 
+// endedAt returns the time at which the enrolment was completed or expired.
+func (enr Enrolment) endedAt() time.Time {
+	if enr.TotalSteps == len(enr.CompletedSteps) && len(enr.CompletedSteps) > 0 {
+		last := enr.CompletedSteps[0].DoneAt
+		for _, step := range enr.CompletedSteps {
+			if step.DoneAt.After(last) {
+				last = step.DoneAt
+			}
+		}
+		return last
+	}
+	return enr.EndsAt
+}
+
+// progressOf returns the progress of the step, adding it if not present.
+func (enr *Enrolment) progressOf(stepID int) *StepProgress {
+	for i := range enr.Progress {
+		if enr.Progress[i].StepID == stepID {
+			return &enr.Progress[i]
+		}
+	}
+	enr.Progress = append(enr.Progress, StepProgress{StepID: stepID})
+	return &enr.Progress[len(enr.Progress)-1]
+}
+
+// clearProgress removes the progress of the step.
+func (enr *Enrolment) clearProgress(stepID int) {
+	var res []StepProgress
+	for _, prog := range enr.Progress {
+		if prog.StepID != stepID {
+			res = append(res, prog)
+		}
+	}
+	enr.Progress = res
+}
+
 func (enr *Enrolment) validate() error {
 	enr.ActorID = strings.TrimSpace(enr.ActorID)
 	enr.StartedAt = enr.StartedAt.UTC()
@@ -58,9 +141,53 @@ func (enr *Enrolment) validate() error {
 		step := &enr.CompletedSteps[i]
 		step.ActionID = strings.TrimSpace(step.ActionID)
 		step.DoneAt = step.DoneAt.UTC()
-		if err := val.Struct(step); err != nil {
-			return err
+	}
+	return invalidFields(val.Struct(enr))
+}
+
+// newValidator returns a validator that reports the fields using their
+// JSON names.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
 		}
+		return name
+	})
+	return v
+}
+
+// invalidFields converts the errors returned by the validator into ErrInvalid
+// with field-level details.
+func invalidFields(err error) error {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		rule := fe.Tag()
+		if fe.Param() != "" {
+			rule += "=" + fe.Param()
+		}
+
+		// namespace is prefixed with the struct name (e.g., 'Enrolment.').
+		field := fe.Namespace()
+		if i := strings.IndexByte(field, '.'); i >= 0 {
+			field = field[i+1:]
+		}
+
+		fields = append(fields, FieldError{
+			Field:   field,
+			Rule:    rule,
+			Message: fmt.Sprintf("must satisfy '%s'", rule),
+		})
 	}
-	return val.Struct(enr)
+
+	return ErrInvalid.
+		WithCausef("%d field(s) are not valid", len(fields)).
+		WithFields(fields...)
 }
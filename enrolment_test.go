@@ -1,10 +1,12 @@
 package enforcer
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEnrolment_computeStatus(t *testing.T) {
@@ -78,9 +80,10 @@ func TestEnrolment_validate(t *testing.T) {
 	t.Parallel()
 
 	table := []struct {
-		title   string
-		sample  Enrolment
-		wantErr bool
+		title      string
+		sample     Enrolment
+		wantErr    bool
+		wantFields []string
 	}{
 		{
 			title: "Invalid",
@@ -92,7 +95,23 @@ func TestEnrolment_validate(t *testing.T) {
 					},
 				},
 			},
-			wantErr: true,
+			wantErr:    true,
+			wantFields: []string{"actor_id", "campaign_id", "completed_steps[0].done_at"},
+		},
+		{
+			title: "Valid",
+			sample: Enrolment{
+				ActorID:    "actor_1",
+				CampaignID: "campaign_1",
+				TotalSteps: 2,
+				CompletedSteps: []StepResult{
+					{
+						StepID:   1,
+						DoneAt:   time.Now(),
+						ActionID: "ORDER/1234",
+					},
+				},
+			},
 		},
 	}
 
@@ -100,7 +119,15 @@ func TestEnrolment_validate(t *testing.T) {
 		t.Run(tt.title, func(t *testing.T) {
 			err := tt.sample.validate()
 			if tt.wantErr {
-				assert.Error(t, err)
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrInvalid))
+
+				var fields []string
+				require.NotNil(t, err.(Error).Fields)
+				for _, f := range *err.(Error).Fields {
+					fields = append(fields, f.Field)
+				}
+				assert.Equal(t, tt.wantFields, fields)
 			} else {
 				assert.NoError(t, err)
 			}
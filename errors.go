@@ -7,13 +7,16 @@ import (
 
 // Common timer domain errors. Use `ErrX.WithCausef()` to clone and add context.
 var (
-	ErrInvalid      = Error{Code: "bad_request", Message: "Request is not valid"}
-	ErrNotFound     = Error{Code: "not_found", Message: "Requested resource not found"}
-	ErrConflict     = Error{Code: "conflict", Message: "A resource with conflicting identifier exists"}
-	ErrIneligible   = Error{Code: "ineligible", Message: "Actor is not eligible for a campaign"}
-	ErrInternal     = Error{Code: "internal_error", Message: "Some unexpected error occurred"}
-	ErrUnsupported  = Error{Code: "unsupported", Message: "Requested feature is not supported"}
-	ErrUnauthorized = Error{Code: "unauthorized", Message: "Client is not authorized for the requested action"}
+	ErrInvalid       = Error{Code: "bad_request", Message: "Request is not valid"}
+	ErrNotFound      = Error{Code: "not_found", Message: "Requested resource not found"}
+	ErrConflict      = Error{Code: "conflict", Message: "A resource with conflicting identifier exists"}
+	ErrIneligible    = Error{Code: "ineligible", Message: "Actor is not eligible for a campaign"}
+	ErrLimitReached  = Error{Code: "limit_reached", Message: "Campaign has reached maximum enrolments"}
+	ErrInternal      = Error{Code: "internal_error", Message: "Some unexpected error occurred"}
+	ErrUnsupported   = Error{Code: "unsupported", Message: "Requested feature is not supported"}
+	ErrUnauthorized  = Error{Code: "unauthorized", Message: "Client is not authorized for the requested action"}
+	ErrForbidden     = Error{Code: "forbidden", Message: "Client is not allowed to perform the requested action"}
+	ErrUnprocessable = Error{Code: "unprocessable", Message: "Request could not be processed by the campaign rules"}
 )
 
 // Error represents any error returned by the Timer components along with any
@@ -22,6 +25,20 @@ type Error struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
 	Cause   string `json:"cause,omitempty"`
+
+	// Fields contains the field-level details of validation errors. It is
+	// kept behind a pointer so that Error values remain comparable.
+	Fields *FieldErrors `json:"fields,omitempty"`
+}
+
+// FieldErrors is the list of fields that failed validation.
+type FieldErrors []FieldError
+
+// FieldError represents a field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 // WithCausef returns clone of err with the cause added.
@@ -38,6 +55,14 @@ func (err Error) WithMsgf(msg string, args ...interface{}) Error {
 	return cloned
 }
 
+// WithFields returns a clone of the error with the field-level details set.
+func (err Error) WithFields(fields ...FieldError) Error {
+	cloned := err
+	details := FieldErrors(fields)
+	cloned.Fields = &details
+	return cloned
+}
+
 // Is checks if 'other' is of type Error and has the same code.
 // See https://blog.golang.org/go1.13-errors.
 func (err Error) Is(other error) bool {
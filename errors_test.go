@@ -73,6 +73,17 @@ func TestError_Is(t *testing.T) {
 	}
 }
 
+func TestError_Comparable(t *testing.T) {
+	t.Parallel()
+
+	var err error = enforcer.ErrInvalid.WithFields(enforcer.FieldError{Field: "actor_id", Rule: "required"})
+	assert.NotPanics(t, func() {
+		assert.False(t, err == enforcer.ErrNotFound)
+		assert.False(t, err == enforcer.ErrInvalid)
+	})
+	assert.True(t, goerrors.Is(err, enforcer.ErrInvalid))
+}
+
 func TestError_WithCausef(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,98 @@
+package enforcer
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Types of enrolment lifecycle events.
+const (
+	EventEnrolled          = "enrolled"
+	EventStepCompleted     = "step_completed"
+	EventCampaignCompleted = "campaign_completed"
+	EventExpired           = "expired"
+)
+
+// Event represents a change in the lifecycle of an enrolment. ID is derived
+// from the enrolment and the change, so that consumers can use it to drop
+// duplicates.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	ActorID    string    `json:"actor_id"`
+	CampaignID string    `json:"campaign_id"`
+	StepID     *int      `json:"step_id,omitempty"`
+	ActionID   string    `json:"action_id,omitempty"`
+	Enrolment  Enrolment `json:"enrolment"`
+}
+
+// Publisher publishes lifecycle events drained from the outbox by Relay.
+// Events may be published more than once (e.g., if the relay crashes before
+// acknowledging them), so publishers and consumers must be idempotent.
+type Publisher interface {
+	Publish(ctx context.Context, events []Event) error
+}
+
+// newEvent returns an event of given type for the enrolment. stepID must be
+// negative for events not related to a step.
+func newEvent(typ string, enr Enrolment, stepID int, actionID string, at time.Time) Event {
+	enr.setStatus()
+	id := fmt.Sprintf("%s:%s:%d:%s", enr.ActorID, enr.CampaignID, enr.Iteration, typ)
+
+	evt := Event{
+		Type:       typ,
+		Time:       at,
+		ActorID:    enr.ActorID,
+		CampaignID: enr.CampaignID,
+		ActionID:   actionID,
+		Enrolment:  enr,
+	}
+	if stepID >= 0 {
+		id = fmt.Sprintf("%s:%d", id, stepID)
+		evt.StepID = &stepID
+	}
+	evt.ID = id
+	return evt
+}
+
+// ingestEvents returns the events for the progress made in the enrolment by
+// the ingested action.
+func ingestEvents(res IngestResult, enr Enrolment, act Action) []Event {
+	var events []Event
+	if res.Enrolled {
+		events = append(events, newEvent(EventEnrolled, enr, -1, act.ID, act.Time))
+	}
+	if res.Partial {
+		return events
+	}
+
+	events = append(events, newEvent(EventStepCompleted, enr, res.StepID, act.ID, act.Time))
+	if enr.TotalSteps == len(enr.CompletedSteps) {
+		events = append(events, newEvent(EventCampaignCompleted, enr, -1, act.ID, act.Time))
+	}
+	return events
+}
+
+// events returns the given events only if the API records events.
+func (api *API) events(events ...Event) []Event {
+	if !api.RecordEvents {
+		return nil
+	}
+	return events
+}
+
+// checkExpiry records the expiry event for the enrolment if it is expired
+// and the event is not recorded already. This is a no-op if the API does
+// not record events.
+func (api *API) checkExpiry(ctx context.Context, enr *Enrolment) error {
+	enr.setStatus()
+	if !api.RecordEvents || enr.Status != StatusExpired || enr.ExpiryNotified {
+		return nil
+	}
+
+	enr.ExpiryNotified = true
+	enr.Version++
+	return api.Store.UpsertEnrolment(ctx, *enr, newEvent(EventExpired, *enr, -1, "", time.Now()))
+}
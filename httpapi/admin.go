@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/webhook"
+)
+
+func listDeliveries(hooks webhooksAPI) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		status := req.URL.Query().Get("status")
+		switch status {
+		case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusDead:
+
+		default:
+			writeErr(wr, req, enforcer.ErrInvalid.WithMsgf("status '%s' is not valid", status))
+			return
+		}
+
+		deliveries := hooks.Deliveries(status)
+		if deliveries == nil {
+			deliveries = []webhook.Delivery{}
+		}
+		writeOut(wr, req, http.StatusOK, genMap{"deliveries": deliveries})
+	}
+}
+
+func invalidateActor(cache actorCache) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		cache.Invalidate(chi.URLParam(req, "actor_id"))
+		writeOut(wr, req, http.StatusNoContent)
+	}
+}
+
+func getRuleStats(stats ruleStats) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		st := stats.Stats()
+		writeOut(wr, req, http.StatusOK, genMap{
+			"hits":      st.Hits,
+			"misses":    st.Misses,
+			"size":      st.Size,
+			"hit_ratio": st.HitRatio(),
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/resolver"
+	"github.com/spy16/enforcer/rule"
+	"github.com/spy16/enforcer/stores/inmem"
+)
+
+func TestAdmin_RuleStats(t *testing.T) {
+	t.Parallel()
+
+	engine := rule.New()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: engine}
+	h := newRouter(api, resolver.None{}, nil, nil, false)
+
+	env := map[string]interface{}{"event": map[string]interface{}{"type": "PURCHASE"}}
+	for i := 0; i < 2; i++ {
+		_, err := engine.Exec(context.Background(), "event.type == 'PURCHASE'", env)
+		require.NoError(t, err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/admin/rules/stats", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var body struct {
+		Hits     uint64  `json:"hits"`
+		Misses   uint64  `json:"misses"`
+		Size     int     `json:"size"`
+		HitRatio float64 `json:"hit_ratio"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, uint64(1), body.Hits)
+	assert.Equal(t, uint64(1), body.Misses)
+	assert.Equal(t, 1, body.Size)
+	assert.InDelta(t, 0.5, body.HitRatio, 0.0001)
+}
@@ -0,0 +1,268 @@
+package httpapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/enforcer"
+)
+
+// Scopes granted to the clients.
+const (
+	// ScopeAdmin allows campaign administration, admin endpoints and all
+	// the actor routes.
+	ScopeAdmin = "admin"
+
+	// ScopeClient allows reading campaigns and the actor routes. Client
+	// can act only for the actor it is bound to (i.e., subject of the JWT
+	// or the actor the API key is bound to in Auth.KeyActors).
+	ScopeClient = "client"
+)
+
+const headerAPIKey = "X-API-Key"
+
+// Auth configures authentication of requests. Clients authenticate using
+// an API key (in 'X-API-Key' header) or a JWT signed using HS256 or RS256
+// (in 'Authorization: Bearer <token>' header). Scopes of a JWT are read
+// from the space-separated 'scope' claim.
+type Auth struct {
+	// APIKeys maps the API keys to the scopes granted.
+	APIKeys map[string][]string
+
+	// KeyActors binds the API keys to the actors. API keys without the
+	// admin scope can be used on the actor routes only for the bound actor.
+	KeyActors map[string]string
+
+	// HMACSecret (if set) is used to verify HS256 tokens.
+	HMACSecret []byte
+
+	// RSAPublicKey (if set) is used to verify RS256 tokens.
+	RSAPublicKey *rsa.PublicKey
+
+	// Issuer and Audience (if set) must match the 'iss' and 'aud' claims.
+	Issuer   string
+	Audience string
+
+	// AllowNoExpiry accepts the tokens without the 'exp' claim, which never
+	// expire. Such tokens are rejected by default.
+	AllowNoExpiry bool
+}
+
+// principal is the authenticated client. Subject of clients using API keys is
+// derived from the key. Actor is the actor the client can act for, if any.
+type principal struct {
+	Subject string
+	Scopes  []string
+	Actor   string
+}
+
+func (p principal) hasScope(scopes ...string) bool {
+	for _, s := range scopes {
+		for _, granted := range p.Scopes {
+			if s == granted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type principalCtxKey struct{}
+
+// authenticate rejects requests without valid credentials and attaches the
+// principal to the context.
+func (a *Auth) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		p, err := a.principal(req)
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), principalCtxKey{}, *p)
+		next.ServeHTTP(wr, req.WithContext(enforcer.WithAuthor(ctx, p.Subject)))
+	})
+}
+
+// require rejects requests from principals without any of the scopes. It
+// is a no-op if auth is not configured.
+func (a *Auth) require(scopes ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+			p, _ := req.Context().Value(principalCtxKey{}).(principal)
+			if !p.hasScope(scopes...) {
+				writeErr(wr, req, enforcer.ErrForbidden.
+					WithCausef("one of the scopes %v is required", scopes))
+				return
+			}
+			next.ServeHTTP(wr, req)
+		})
+	}
+}
+
+// requireActor rejects requests from non-admin clients that are not bound to
+// the actor in the route. It is a no-op if auth is not configured.
+func (a *Auth) requireActor(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		p, _ := req.Context().Value(principalCtxKey{}).(principal)
+		actorID := chi.URLParam(req, "actor_id")
+		if !p.hasScope(ScopeAdmin) && p.Actor != actorID {
+			writeErr(wr, req, enforcer.ErrForbidden.
+				WithCausef("credentials are not valid for actor '%s'", actorID))
+			return
+		}
+		next.ServeHTTP(wr, req)
+	})
+}
+
+func (a *Auth) principal(req *http.Request) (*principal, error) {
+	if key := req.Header.Get(headerAPIKey); key != "" {
+		for k, scopes := range a.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				// subject identifies the key without revealing it.
+				sum := sha256.Sum256([]byte(k))
+				return &principal{
+					Subject: "key:" + hex.EncodeToString(sum[:4]),
+					Scopes:  scopes,
+					Actor:   a.KeyActors[k],
+				}, nil
+			}
+		}
+		return nil, enforcer.ErrUnauthorized.WithCausef("api key is not valid")
+	}
+
+	authz := req.Header.Get("Authorization")
+	if len(authz) > 7 && strings.EqualFold(authz[:7], "Bearer ") {
+		return a.verifyToken(strings.TrimSpace(authz[7:]), time.Now())
+	}
+
+	return nil, enforcer.ErrUnauthorized.WithCausef("api key or bearer token is required")
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  interface{} `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	Scope     string      `json:"scope"`
+}
+
+// verifyToken verifies the signature and claims of the JWT.
+func (a *Auth) verifyToken(token string, now time.Time) (*principal, error) {
+	invalid := func(reason string) error {
+		return enforcer.ErrUnauthorized.WithCausef("token is not valid: %s", reason)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalid("malformed header")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("malformed signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && len(a.HMACSecret) > 0:
+		mac := hmac.New(sha256.New, a.HMACSecret)
+		_, _ = mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return nil, invalid("signature mismatch")
+		}
+
+	case header.Alg == "RS256" && a.RSAPublicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(a.RSAPublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			return nil, invalid("signature mismatch")
+		}
+
+	default:
+		return nil, invalid("algorithm '" + header.Alg + "' is not allowed")
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalid("malformed claims")
+	}
+
+	unix := float64(now.Unix())
+	switch {
+	case claims.Subject == "":
+		return nil, invalid("subject is required")
+
+	case claims.ExpiresAt == nil && !a.AllowNoExpiry:
+		return nil, invalid("expiry is required")
+
+	case claims.ExpiresAt != nil && unix >= *claims.ExpiresAt:
+		return nil, invalid("token has expired")
+
+	case claims.NotBefore != nil && unix < *claims.NotBefore:
+		return nil, invalid("token is not valid yet")
+
+	case a.Issuer != "" && claims.Issuer != a.Issuer:
+		return nil, invalid("issuer mismatch")
+
+	case a.Audience != "" && !hasAudience(claims.Audience, a.Audience):
+		return nil, invalid("audience mismatch")
+	}
+
+	return &principal{
+		Subject: claims.Subject,
+		Scopes:  strings.Fields(claims.Scope),
+		Actor:   claims.Subject,
+	}, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// hasAudience checks the 'aud' claim which can be a string or an array.
+func hasAudience(aud interface{}, want string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == want
+
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/resolver"
+	"github.com/spy16/enforcer/rule"
+	"github.com/spy16/enforcer/stores/inmem"
+)
+
+var hmacSecret = []byte("secret")
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	auth := &Auth{
+		APIKeys: map[string][]string{
+			"admin-key":   {ScopeAdmin},
+			"service-key": {ScopeClient},
+			"actor-key":   {ScopeClient},
+		},
+		KeyActors:    map[string]string{"actor-key": "actor_1"},
+		HMACSecret:   hmacSecret,
+		RSAPublicKey: &rsaKey.PublicKey,
+		Issuer:       "idp",
+	}
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	actors := &resolver.Cached{Resolver: resolver.Supplied{}, TTL: time.Minute}
+	h := newRouter(api, actors, nil, auth, false)
+
+	exp := time.Now().Add(1 * time.Hour).Unix()
+	client := map[string]interface{}{"sub": "actor_1", "iss": "idp", "scope": "client", "exp": exp}
+	admin := map[string]interface{}{"sub": "ops", "iss": "idp", "scope": "admin", "exp": exp}
+	expired := map[string]interface{}{"sub": "actor_1", "iss": "idp", "scope": "client", "exp": time.Now().Add(-1 * time.Minute).Unix()}
+	otherIssuer := map[string]interface{}{"sub": "actor_1", "iss": "other", "scope": "client", "exp": exp}
+	noExpiry := map[string]interface{}{"sub": "ops", "iss": "idp", "scope": "admin"}
+
+	table := []struct {
+		title  string
+		method string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{title: "Ping", method: http.MethodGet, path: "/ping", want: http.StatusOK},
+		{title: "NoCredentials", method: http.MethodGet, path: "/v1/campaigns", want: http.StatusUnauthorized},
+		{title: "InvalidAPIKey", method: http.MethodGet, path: "/v1/campaigns", header: map[string]string{headerAPIKey: "foo"}, want: http.StatusUnauthorized},
+		{title: "AdminKey", method: http.MethodPost, path: "/v1/campaigns", header: map[string]string{headerAPIKey: "admin-key"}, want: http.StatusBadRequest},
+		{title: "ClientKey_ReadCampaigns", method: http.MethodGet, path: "/v1/campaigns", header: map[string]string{headerAPIKey: "service-key"}, want: http.StatusOK},
+		{title: "ClientKey_CreateCampaign", method: http.MethodPost, path: "/v1/campaigns", header: map[string]string{headerAPIKey: "service-key"}, want: http.StatusForbidden},
+		{title: "ClientKey_Unbound", method: http.MethodGet, path: "/v1/actors/actor_2/enrolments", header: map[string]string{headerAPIKey: "service-key"}, want: http.StatusForbidden},
+		{title: "ClientKey_BoundActor", method: http.MethodGet, path: "/v1/actors/actor_1/enrolments", header: map[string]string{headerAPIKey: "actor-key"}, want: http.StatusOK},
+		{title: "ClientKey_OtherActor", method: http.MethodGet, path: "/v1/actors/actor_2/enrolments", header: map[string]string{headerAPIKey: "actor-key"}, want: http.StatusForbidden},
+		{title: "AdminKey_AnyActor", method: http.MethodGet, path: "/v1/actors/actor_2/enrolments", header: map[string]string{headerAPIKey: "admin-key"}, want: http.StatusOK},
+		{title: "AdminKey_Admin", method: http.MethodDelete, path: "/v1/admin/actors/actor_1/cache", header: map[string]string{headerAPIKey: "admin-key"}, want: http.StatusNoContent},
+		{title: "ClientKey_Admin", method: http.MethodDelete, path: "/v1/admin/actors/actor_1/cache", header: map[string]string{headerAPIKey: "service-key"}, want: http.StatusForbidden},
+		{title: "HS256_OwnActor", method: http.MethodGet, path: "/v1/actors/actor_1/enrolments", header: bearer(hs256(client)), want: http.StatusOK},
+		{title: "HS256_OtherActor", method: http.MethodGet, path: "/v1/actors/actor_2/enrolments", header: bearer(hs256(client)), want: http.StatusForbidden},
+		{title: "RS256_OwnActor", method: http.MethodGet, path: "/v1/actors/actor_1/enrolments", header: bearer(rs256(t, rsaKey, client)), want: http.StatusOK},
+		{title: "RS256_Admin_OtherActor", method: http.MethodGet, path: "/v1/actors/actor_2/enrolments", header: bearer(rs256(t, rsaKey, admin)), want: http.StatusOK},
+		{title: "Expired", method: http.MethodGet, path: "/v1/actors/actor_1/enrolments", header: bearer(hs256(expired)), want: http.StatusUnauthorized},
+		{title: "NoExpiry", method: http.MethodGet, path: "/v1/actors/actor_1/enrolments", header: bearer(hs256(noExpiry)), want: http.StatusUnauthorized},
+		{title: "IssuerMismatch", method: http.MethodGet, path: "/v1/actors/actor_1/enrolments", header: bearer(hs256(otherIssuer)), want: http.StatusUnauthorized},
+		{title: "AlgNone", method: http.MethodGet, path: "/v1/actors/actor_1/enrolments", header: bearer(unsigned(client)), want: http.StatusUnauthorized},
+		{title: "TamperedClaims", method: http.MethodGet, path: "/v1/actors/actor_1/enrolments", header: bearer(tamper(hs256(client), admin)), want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestAuth_AllowNoExpiry(t *testing.T) {
+	t.Parallel()
+
+	token := hs256(map[string]interface{}{"sub": "ops", "scope": "admin"})
+
+	_, err := (&Auth{HMACSecret: hmacSecret}).verifyToken(token, time.Now())
+	assert.True(t, errors.Is(err, enforcer.ErrUnauthorized), "token without expiry must be rejected by default")
+
+	p, err := (&Auth{HMACSecret: hmacSecret, AllowNoExpiry: true}).verifyToken(token, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "ops", p.Subject)
+}
+
+func TestAuth_Disabled(t *testing.T) {
+	t.Parallel()
+
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	h := newRouter(api, resolver.Supplied{}, nil, nil, false)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/actors/actor_1/enrolments", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func hs256(claims map[string]interface{}) string {
+	signed := segment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + segment(claims)
+	mac := hmac.New(sha256.New, hmacSecret)
+	_, _ = mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signed := segment(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func unsigned(claims map[string]interface{}) string {
+	return segment(map[string]string{"alg": "none"}) + "." + segment(claims) + "."
+}
+
+func tamper(token string, claims map[string]interface{}) string {
+	parts := strings.Split(token, ".")
+	return parts[0] + "." + segment(claims) + "." + parts[2]
+}
+
+func segment(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -2,7 +2,10 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
@@ -10,6 +13,11 @@ import (
 	"github.com/spy16/enforcer"
 )
 
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
 func getCampaign(api campaignsAPI) http.HandlerFunc {
 	return func(wr http.ResponseWriter, req *http.Request) {
 		campID := strings.TrimSpace(chi.URLParam(req, "id"))
@@ -20,6 +28,7 @@ func getCampaign(api campaignsAPI) http.HandlerFunc {
 			return
 		}
 
+		setETag(wr, *c)
 		writeOut(wr, req, http.StatusOK, c)
 	}
 }
@@ -27,14 +36,22 @@ func getCampaign(api campaignsAPI) http.HandlerFunc {
 func listCampaigns(api campaignsAPI) http.HandlerFunc {
 	return func(wr http.ResponseWriter, req *http.Request) {
 		p := req.URL.Query()
+		page, err := parsePage(p)
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+
 		q := enforcer.Query{
 			Include:    cleanSplit(p.Get("include"), ","),
 			SearchIn:   cleanSplit(p.Get("search_in"), ","),
 			HavingTags: cleanSplit(p.Get("tags"), ","),
 			OnlyActive: p.Get("only_active") == "true",
+			Sort:       p.Get("sort"),
+			Page:       page,
 		}
 
-		camps, err := api.ListCampaigns(req.Context(), q)
+		camps, next, err := api.ListCampaigns(req.Context(), q)
 		if err != nil {
 			writeErr(wr, req, err)
 			return
@@ -43,7 +60,10 @@ func listCampaigns(api campaignsAPI) http.HandlerFunc {
 			camps = []enforcer.Campaign{}
 		}
 
-		writeOut(wr, req, http.StatusOK, camps)
+		writeOut(wr, req, http.StatusOK, genMap{
+			"campaigns":   camps,
+			"next_cursor": next,
+		})
 	}
 }
 
@@ -61,6 +81,7 @@ func createCampaign(api campaignsAPI) http.HandlerFunc {
 			return
 		}
 
+		setETag(wr, *created)
 		writeOut(wr, req, http.StatusCreated, created)
 	}
 }
@@ -75,12 +96,21 @@ func updateCampaign(api campaignsAPI) http.HandlerFunc {
 			return
 		}
 
-		c, err := api.UpdateCampaign(req.Context(), campID, upd)
+		version, err := parseIfMatch(req)
 		if err != nil {
 			writeErr(wr, req, err)
 			return
+		} else if version != 0 {
+			upd.Version = version
 		}
 
+		c, err := api.UpdateCampaign(req.Context(), campID, upd)
+		if err != nil {
+			writeVersionErr(wr, req, upd.Version, err)
+			return
+		}
+
+		setETag(wr, *c)
 		writeOut(wr, req, http.StatusOK, c)
 	}
 }
@@ -89,16 +119,71 @@ func deleteCampaign(api campaignsAPI) http.HandlerFunc {
 	return func(wr http.ResponseWriter, req *http.Request) {
 		campID := strings.TrimSpace(chi.URLParam(req, "id"))
 
-		err := api.DeleteCampaign(req.Context(), campID)
+		version, err := parseIfMatch(req)
 		if err != nil {
 			writeErr(wr, req, err)
 			return
 		}
 
+		if err := api.DeleteCampaign(req.Context(), campID, version); err != nil {
+			writeVersionErr(wr, req, version, err)
+			return
+		}
+
 		writeOut(wr, req, http.StatusNoContent)
 	}
 }
 
+// setETag sets the version of the campaign as the entity tag.
+func setETag(wr http.ResponseWriter, c enforcer.Campaign) {
+	wr.Header().Set("ETag", strconv.Quote(strconv.Itoa(c.Version)))
+}
+
+// parseIfMatch returns the campaign version from the 'If-Match' header. Zero
+// is returned if the header is not set or is '*'.
+func parseIfMatch(req *http.Request) (int, error) {
+	tag := strings.TrimSpace(req.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(tag, "W/"), `"`))
+	if err != nil || version <= 0 {
+		return 0, enforcer.ErrInvalid.
+			WithMsgf("invalid If-Match header '%s'", tag).
+			WithCausef("must be an entity tag returned in the ETag header")
+	}
+	return version, nil
+}
+
+// writeVersionErr writes ErrConflict for requests with an expected version
+// as 412 (i.e., the campaign has been modified since it was read).
+func writeVersionErr(wr http.ResponseWriter, req *http.Request, version int, err error) {
+	if version != 0 && errors.Is(err, enforcer.ErrConflict) {
+		writeErrStatus(wr, req, http.StatusPreconditionFailed, err)
+		return
+	}
+	writeErr(wr, req, err)
+}
+
+func parsePage(p url.Values) (enforcer.Page, error) {
+	page := enforcer.Page{
+		Limit:  defaultLimit,
+		Cursor: strings.TrimSpace(p.Get("cursor")),
+	}
+
+	if s := strings.TrimSpace(p.Get("limit")); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxLimit {
+			return page, enforcer.ErrInvalid.
+				WithMsgf("invalid limit '%s'", s).
+				WithCausef("must be an integer in range [1, %d]", maxLimit)
+		}
+		page.Limit = limit
+	}
+	return page, nil
+}
+
 func cleanSplit(s, sep string) []string {
 	var res []string
 	for _, item := range strings.Split(s, sep) {
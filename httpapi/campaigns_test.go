@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/resolver"
+	"github.com/spy16/enforcer/rule"
+	"github.com/spy16/enforcer/stores/inmem"
+)
+
+func TestCampaigns_IfMatch(t *testing.T) {
+	t.Parallel()
+
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	h := newRouter(api, resolver.Supplied{}, nil, nil, false)
+
+	do := func(method, path, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/campaigns", "", `{
+		"id": "camp_1",
+		"start_at": "2030-01-01T00:00:00Z",
+		"end_at": "2030-02-01T00:00:00Z",
+		"steps": [{"rule": "event.type == 'PURCHASE'"}]
+	}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+
+	rec = do(http.MethodPut, "/v1/campaigns/camp_1", `"1"`, `{"priority": 1}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	rec = do(http.MethodPut, "/v1/campaigns/camp_1", `"1"`, `{"priority": 2}`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodPut, "/v1/campaigns/camp_1", `foo`, `{"priority": 2}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodGet, "/v1/campaigns/camp_1", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	rec = do(http.MethodDelete, "/v1/campaigns/camp_1", `"1"`, "")
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodDelete, "/v1/campaigns/camp_1", `W/"2"`, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+}
+
+func TestCampaigns_Revisions(t *testing.T) {
+	t.Parallel()
+
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	auth := &Auth{APIKeys: map[string][]string{"admin-key": {ScopeAdmin}}}
+	h := newRouter(api, resolver.Supplied{}, nil, auth, false)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(headerAPIKey, "admin-key")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/campaigns", `{
+		"id": "camp_1",
+		"start_at": "2030-01-01T00:00:00Z",
+		"end_at": "2030-02-01T00:00:00Z",
+		"steps": [{"rule": "event.type == 'PURCHASE'"}]
+	}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodPut, "/v1/campaigns/camp_1", `{"priority": 1}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodGet, "/v1/campaigns/camp_1/revisions", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"author":"key:`)
+
+	rec = do(http.MethodGet, "/v1/campaigns/camp_1/diff?from=1&to=2", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"field":"priority"`)
+
+	rec = do(http.MethodGet, "/v1/campaigns/camp_1/diff?from=1", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodPost, "/v1/campaigns/camp_1/rollback", `{"version": 1}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+
+	rec = do(http.MethodGet, "/v1/campaigns/camp_1/revisions/3", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"priority":0`)
+}
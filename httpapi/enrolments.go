@@ -2,21 +2,23 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/resolver"
 )
 
-func getEnrolment(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
+func getEnrolment(api enrolmentsAPI, actors enforcer.ActorResolver) http.HandlerFunc {
 	return func(wr http.ResponseWriter, req *http.Request) {
 		actorID := chi.URLParam(req, "actor_id")
 		campID := chi.URLParam(req, "campaign_id")
 
-		ac, err := getActor(req.Context(), actorID)
+		ac, err := resolveActor(req, actors, actorID, nil)
 		if err != nil {
-			writeErr(wr, req, enforcer.ErrInvalid.WithCausef("actor '%s' not found", actorID))
+			writeErr(wr, req, err)
 			return
 		}
 
@@ -30,37 +32,52 @@ func getEnrolment(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
 	}
 }
 
-func listEnrolments(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
+func listEnrolments(api enrolmentsAPI, actors enforcer.ActorResolver) http.HandlerFunc {
 	return func(wr http.ResponseWriter, req *http.Request) {
 		actorID := chi.URLParam(req, "actor_id")
-		ac, err := getActor(req.Context(), actorID)
+		ac, err := resolveActor(req, actors, actorID, nil)
 		if err != nil {
-			writeErr(wr, req, enforcer.ErrInvalid.WithCausef("actor '%s' not found", actorID))
+			writeErr(wr, req, err)
 			return
 		}
 
 		p := req.URL.Query()
+		page, err := parsePage(p)
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+
 		q := enforcer.Query{
 			OnlyActive: p.Get("only_active") == "true",
 			Include:    cleanSplit(p.Get("include"), ","),
 			SearchIn:   cleanSplit(p.Get("search_in"), ","),
 			HavingTags: cleanSplit(p.Get("tags"), ","),
+			Sort:       p.Get("sort"),
+			Page:       page,
 		}
 
-		enrolmentList, err := api.ListAllEnrolments(req.Context(), *ac, q)
+		enrolmentList, next, err := api.ListAllEnrolments(req.Context(), *ac, q)
 		if err != nil {
 			writeErr(wr, req, err)
 			return
 		}
+		if enrolmentList == nil {
+			enrolmentList = []enforcer.Enrolment{}
+		}
 
-		writeOut(wr, req, http.StatusOK, enrolmentList)
+		writeOut(wr, req, http.StatusOK, genMap{
+			"enrolments":  enrolmentList,
+			"next_cursor": next,
+		})
 	}
 }
 
-func enrol(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
+func enrol(api enrolmentsAPI, actors enforcer.ActorResolver) http.HandlerFunc {
 	return func(wr http.ResponseWriter, req *http.Request) {
 		var body struct {
-			CampaignID string `json:"campaign_id"`
+			CampaignID string                 `json:"campaign_id"`
+			Attribs    map[string]interface{} `json:"attribs"`
 		}
 		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
 			writeErr(wr, req, enforcer.ErrInvalid.WithCausef("failed to parse body: %v", err))
@@ -68,9 +85,9 @@ func enrol(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
 		}
 
 		actorID := chi.URLParam(req, "actor_id")
-		ac, err := getActor(req.Context(), actorID)
+		ac, err := resolveActor(req, actors, actorID, body.Attribs)
 		if err != nil {
-			writeErr(wr, req, enforcer.ErrInvalid.WithCausef("actor '%s' not found", actorID))
+			writeErr(wr, req, err)
 			return
 		}
 
@@ -88,11 +105,12 @@ func enrol(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
 	}
 }
 
-func ingest(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
+func ingest(api enrolmentsAPI, actors enforcer.ActorResolver) http.HandlerFunc {
 	return func(wr http.ResponseWriter, req *http.Request) {
 		var body struct {
-			Multi  bool            `json:"multi"`
-			Action enforcer.Action `json:"action"`
+			Multi   bool                   `json:"multi"`
+			Action  enforcer.Action        `json:"action"`
+			Attribs map[string]interface{} `json:"attribs"`
 		}
 		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
 			writeErr(wr, req, enforcer.ErrInvalid.WithCausef("failed to parse body: %v", err))
@@ -100,12 +118,16 @@ func ingest(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
 		}
 
 		actorID := chi.URLParam(req, "actor_id")
-		ac, err := getActor(req.Context(), actorID)
+		ac, err := resolveActor(req, actors, actorID, body.Attribs)
 		if err != nil {
-			writeErr(wr, req, enforcer.ErrInvalid.WithCausef("actor '%s' not found", actorID))
+			writeErr(wr, req, err)
 			return
 		}
 		body.Action.ActorID = ac.ID
+		if err := body.Action.Validate(); err != nil {
+			writeErr(wr, req, err)
+			return
+		}
 
 		enr, err := api.Ingest(req.Context(), body.Multi, *ac, body.Action)
 		if err != nil {
@@ -119,3 +141,16 @@ func ingest(api enrolmentsAPI, getActor getActor) http.HandlerFunc {
 		writeOut(wr, req, http.StatusOK, enr)
 	}
 }
+
+// resolveActor resolves the actor using the attributes supplied by the
+// client (if any).
+func resolveActor(req *http.Request, actors enforcer.ActorResolver, actorID string, attribs map[string]interface{}) (*enforcer.Actor, error) {
+	ac, err := actors.Resolve(resolver.WithAttribs(req.Context(), attribs), actorID)
+	if err != nil {
+		if errors.Is(err, enforcer.ErrNotFound) {
+			return nil, enforcer.ErrInvalid.WithCausef("actor '%s' not found", actorID)
+		}
+		return nil, err
+	}
+	return ac, nil
+}
@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/resolver"
+	"github.com/spy16/enforcer/rule"
+	"github.com/spy16/enforcer/stores/inmem"
+)
+
+func TestIngest_InvalidFields(t *testing.T) {
+	t.Parallel()
+
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	h := newRouter(api, resolver.Supplied{}, nil, nil, false)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/actors/actor_1/ingest", strings.NewReader(`{
+		"action": {"data": {"type": "PURCHASE"}}
+	}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code, rec.Body.String())
+
+	var body enforcer.Error
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, enforcer.ErrInvalid.Code, body.Code)
+	require.NotNil(t, body.Fields)
+	require.Len(t, *body.Fields, 1)
+	assert.Equal(t, "id", (*body.Fields)[0].Field)
+	assert.Equal(t, "required", (*body.Fields)[0].Rule)
+}
+
+func TestIngest_RuleFailureCause(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	api := &enforcer.API{Store: &inmem.Store{}, Engine: rule.New()}
+	_, err := api.CreateCampaign(ctx, enforcer.Campaign{
+		ID:        "camp_1",
+		Enabled:   true,
+		StartAt:   time.Now().Add(-time.Hour),
+		EndAt:     time.Now().Add(time.Hour),
+		AutoEnrol: true,
+		Steps:     []enforcer.Step{{Rule: "event.amount > 10"}},
+	})
+	require.NoError(t, err)
+
+	for _, debug := range []bool{false, true} {
+		h := newRouter(api, resolver.None{}, nil, nil, debug)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/actors/actor_1/ingest", strings.NewReader(`{
+			"action": {"id": "act_1", "data": {"amount": "ten"}}
+		}`))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code, rec.Body.String())
+
+		var body enforcer.Error
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Contains(t, body.Message, "camp_1")
+		if debug {
+			assert.NotEmpty(t, body.Cause, "cause must be reported in debug mode")
+		} else {
+			assert.Empty(t, body.Cause, "cause of rule failures must not be reported")
+		}
+	}
+}
@@ -9,10 +9,21 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/rule"
+	"github.com/spy16/enforcer/webhook"
 )
 
-// Serve starts an REST api server on given bind address.
-func Serve(ctx context.Context, addr string, enforcerAPI *enforcer.API, getActor getActor) error {
+// Serve starts an REST api server on given bind address. Admin endpoints for
+// webhook deliveries are enabled only if hooks is not nil, the endpoint for
+// invalidating cached actors only if the resolver supports it and the endpoint
+// for rule cache statistics only if the rule engine supports it. Requests
+// are not authenticated if auth is nil. Causes of internal errors are sent
+// to the clients only if debug is true.
+func Serve(ctx context.Context, addr string, enforcerAPI *enforcer.API, actors enforcer.ActorResolver, hooks webhooksAPI, auth *Auth, debug bool) error {
+	return serveGraceful(ctx, 10*time.Second, addr, newRouter(enforcerAPI, actors, hooks, auth, debug))
+}
+
+func newRouter(enforcerAPI *enforcer.API, actors enforcer.ActorResolver, hooks webhooksAPI, auth *Auth, debug bool) http.Handler {
 	r := chi.NewRouter()
 	r.Use(
 		middleware.RequestID,
@@ -20,43 +31,91 @@ func Serve(ctx context.Context, addr string, enforcerAPI *enforcer.API, getActor
 		requestLogger,
 		middleware.Recoverer,
 	)
+	if debug {
+		r.Use(withDebug)
+	}
 
 	r.Get("/ping", pingHandler())
-	r.Route("/v1/campaigns", func(r chi.Router) {
-		r.Get("/", listCampaigns(enforcerAPI))
-		r.Post("/", createCampaign(enforcerAPI))
-		r.Get("/{id}", getCampaign(enforcerAPI))
-		r.Put("/{id}", updateCampaign(enforcerAPI))
-		r.Delete("/{id}", deleteCampaign(enforcerAPI))
-	})
 
-	r.Route("/v1/actors/{actor_id}", func(r chi.Router) {
-		r.Get("/enrolments/{campaign_id}", getEnrolment(enforcerAPI, getActor))
-		r.Get("/enrolments", listEnrolments(enforcerAPI, getActor))
-		r.Post("/enrol", enrol(enforcerAPI, getActor))
-		r.Post("/ingest", ingest(enforcerAPI, getActor))
+	r.Group(func(r chi.Router) {
+		if auth != nil {
+			r.Use(auth.authenticate)
+		}
+
+		r.Route("/v1/campaigns", func(r chi.Router) {
+			read, admin := r.With(auth.require(ScopeAdmin, ScopeClient)), r.With(auth.require(ScopeAdmin))
+
+			read.Get("/", listCampaigns(enforcerAPI))
+			admin.Post("/", createCampaign(enforcerAPI))
+			read.Get("/{id}", getCampaign(enforcerAPI))
+			admin.Put("/{id}", updateCampaign(enforcerAPI))
+			admin.Delete("/{id}", deleteCampaign(enforcerAPI))
+			admin.Get("/{id}/revisions", listRevisions(enforcerAPI))
+			admin.Get("/{id}/revisions/{version}", getRevision(enforcerAPI))
+			admin.Get("/{id}/diff", diffRevisions(enforcerAPI))
+			admin.Post("/{id}/rollback", rollbackCampaign(enforcerAPI))
+		})
+
+		r.Route("/v1/actors/{actor_id}", func(r chi.Router) {
+			r.Use(auth.require(ScopeAdmin, ScopeClient), auth.requireActor)
+
+			r.Get("/enrolments/{campaign_id}", getEnrolment(enforcerAPI, actors))
+			r.Get("/enrolments", listEnrolments(enforcerAPI, actors))
+			r.Post("/enrol", enrol(enforcerAPI, actors))
+			r.Post("/ingest", ingest(enforcerAPI, actors))
+		})
+
+		r.Route("/v1/admin", func(r chi.Router) {
+			r.Use(auth.require(ScopeAdmin))
+
+			if hooks != nil {
+				r.Get("/webhooks/deliveries", listDeliveries(hooks))
+			}
+
+			if cache, ok := actors.(actorCache); ok {
+				r.Delete("/actors/{actor_id}/cache", invalidateActor(cache))
+			}
+
+			if stats, ok := enforcerAPI.Engine.(ruleStats); ok {
+				r.Get("/rules/stats", getRuleStats(stats))
+			}
+		})
 	})
 
-	return serveGraceful(ctx, 10*time.Second, addr, r)
+	return r
 }
 
-type getActor func(ctx context.Context, actorID string) (*enforcer.Actor, error)
-
 type campaignsAPI interface {
 	GetCampaign(ctx context.Context, id string) (*enforcer.Campaign, error)
-	ListCampaigns(ctx context.Context, q enforcer.Query) ([]enforcer.Campaign, error)
+	ListCampaigns(ctx context.Context, q enforcer.Query) ([]enforcer.Campaign, string, error)
 	CreateCampaign(ctx context.Context, c enforcer.Campaign) (*enforcer.Campaign, error)
 	UpdateCampaign(ctx context.Context, id string, updates enforcer.Updates) (*enforcer.Campaign, error)
-	DeleteCampaign(ctx context.Context, id string) error
+	DeleteCampaign(ctx context.Context, id string, version int) error
+	ListRevisions(ctx context.Context, id string) ([]enforcer.Revision, error)
+	GetRevision(ctx context.Context, id string, version int) (*enforcer.Revision, error)
+	DiffRevisions(ctx context.Context, id string, from, to int) ([]enforcer.Change, error)
+	RollbackCampaign(ctx context.Context, id string, version, ifVersion int) (*enforcer.Campaign, error)
 }
 
 type enrolmentsAPI interface {
 	GetEnrolment(ctx context.Context, campaignID string, ac enforcer.Actor) (*enforcer.Enrolment, error)
-	ListAllEnrolments(ctx context.Context, ac enforcer.Actor, q enforcer.Query) ([]enforcer.Enrolment, error)
+	ListAllEnrolments(ctx context.Context, ac enforcer.Actor, q enforcer.Query) ([]enforcer.Enrolment, string, error)
 	Enrol(ctx context.Context, campaignID string, act enforcer.Actor) (*enforcer.Enrolment, bool, error)
 	Ingest(ctx context.Context, completeMulti bool, ac enforcer.Actor, act enforcer.Action) ([]enforcer.IngestResult, error)
 }
 
+type webhooksAPI interface {
+	Deliveries(status string) []webhook.Delivery
+}
+
+type actorCache interface {
+	Invalidate(actorID string)
+}
+
+type ruleStats interface {
+	Stats() rule.Stats
+}
+
 func pingHandler() http.HandlerFunc {
 	return func(wr http.ResponseWriter, req *http.Request) {
 		writeOut(wr, req, http.StatusOK, genMap{"status": "ok"})
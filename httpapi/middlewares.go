@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -36,3 +37,18 @@ func (cw *captureWriter) WriteHeader(status int) {
 	cw.ResponseWriter.WriteHeader(status)
 	cw.status = status
 }
+
+type debugCtxKey struct{}
+
+// withDebug marks the requests for exposing causes of internal errors in
+// the responses.
+func withDebug(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(wr, req.WithContext(context.WithValue(req.Context(), debugCtxKey{}, true)))
+	})
+}
+
+func isDebug(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugCtxKey{}).(bool)
+	return debug
+}
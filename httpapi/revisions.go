@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/enforcer"
+)
+
+func listRevisions(api campaignsAPI) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		campID := strings.TrimSpace(chi.URLParam(req, "id"))
+
+		revs, err := api.ListRevisions(req.Context(), campID)
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+
+		writeOut(wr, req, http.StatusOK, genMap{"revisions": revs})
+	}
+}
+
+func getRevision(api campaignsAPI) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		campID := strings.TrimSpace(chi.URLParam(req, "id"))
+
+		version, err := parseVersion("version", chi.URLParam(req, "version"))
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+
+		rev, err := api.GetRevision(req.Context(), campID, version)
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+
+		writeOut(wr, req, http.StatusOK, rev)
+	}
+}
+
+func diffRevisions(api campaignsAPI) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		campID := strings.TrimSpace(chi.URLParam(req, "id"))
+
+		p := req.URL.Query()
+		from, err := parseVersion("from", p.Get("from"))
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+		to, err := parseVersion("to", p.Get("to"))
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+
+		changes, err := api.DiffRevisions(req.Context(), campID, from, to)
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+		if changes == nil {
+			changes = []enforcer.Change{}
+		}
+
+		writeOut(wr, req, http.StatusOK, genMap{
+			"from":    from,
+			"to":      to,
+			"changes": changes,
+		})
+	}
+}
+
+func rollbackCampaign(api campaignsAPI) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		campID := strings.TrimSpace(chi.URLParam(req, "id"))
+
+		var body struct {
+			Version int `json:"version"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeErr(wr, req, enforcer.ErrInvalid.WithCausef("failed to parse body: %v", err))
+			return
+		} else if body.Version <= 0 {
+			writeErr(wr, req, enforcer.ErrInvalid.WithMsgf("version must be a positive integer"))
+			return
+		}
+
+		ifVersion, err := parseIfMatch(req)
+		if err != nil {
+			writeErr(wr, req, err)
+			return
+		}
+
+		c, err := api.RollbackCampaign(req.Context(), campID, body.Version, ifVersion)
+		if err != nil {
+			writeVersionErr(wr, req, ifVersion, err)
+			return
+		}
+
+		setETag(wr, *c)
+		writeOut(wr, req, http.StatusOK, c)
+	}
+}
+
+func parseVersion(name, s string) (int, error) {
+	version, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || version <= 0 {
+		return 0, enforcer.ErrInvalid.
+			WithMsgf("invalid %s '%s'", name, s).
+			WithCausef("must be a positive integer")
+	}
+	return version, nil
+}
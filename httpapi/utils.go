@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog/log"
 
 	"github.com/spy16/enforcer"
@@ -14,24 +15,85 @@ import (
 
 type genMap map[string]interface{}
 
+// errorBody is the body of error responses.
+type errorBody struct {
+	enforcer.Error
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeErr writes the error with a status based on its kind. Causes of the
+// internal errors and of the rule evaluation failures (which may reveal the
+// rules and the actor attributes) are logged and are hidden from the clients
+// unless debug mode is enabled.
 func writeErr(wr http.ResponseWriter, req *http.Request, err error) {
-	switch {
-	case errors.Is(err, enforcer.ErrNotFound):
-		writeOut(wr, req, http.StatusNotFound, err)
+	writeErrStatus(wr, req, 0, err)
+}
 
-	case errors.Is(err, enforcer.ErrInvalid):
-		writeOut(wr, req, http.StatusBadRequest, err)
+// writeErrStatus is same as writeErr but writes the given status instead of
+// the one based on the error kind if status is non-zero.
+func writeErrStatus(wr http.ResponseWriter, req *http.Request, status int, err error) {
+	var e enforcer.Error
+	if !errors.As(err, &e) {
+		e = enforcer.ErrInternal.WithCausef("%v", err)
+	}
 
-	case errors.Is(err, enforcer.ErrIneligible):
-		writeOut(wr, req, http.StatusBadRequest, err)
+	kindStatus := http.StatusInternalServerError
+	switch {
+	case errors.Is(e, enforcer.ErrNotFound):
+		kindStatus = http.StatusNotFound
+
+	case errors.Is(e, enforcer.ErrInvalid) && e.Fields != nil:
+		// request is well-formed but some of the fields are not valid.
+		kindStatus = http.StatusUnprocessableEntity
+
+	case errors.Is(e, enforcer.ErrInvalid), errors.Is(e, enforcer.ErrIneligible):
+		kindStatus = http.StatusBadRequest
+
+	case errors.Is(e, enforcer.ErrConflict), errors.Is(e, enforcer.ErrLimitReached):
+		kindStatus = http.StatusConflict
+
+	case errors.Is(e, enforcer.ErrUnauthorized):
+		wr.Header().Set("WWW-Authenticate", "Bearer")
+		kindStatus = http.StatusUnauthorized
+
+	case errors.Is(e, enforcer.ErrForbidden):
+		kindStatus = http.StatusForbidden
+
+	case errors.Is(e, enforcer.ErrUnprocessable):
+		kindStatus = http.StatusUnprocessableEntity
+		if !isDebug(req.Context()) && e.Cause != "" {
+			log.Warn().
+				Str("request_id", middleware.GetReqID(req.Context())).
+				Err(err).
+				Msg("request failed with rule evaluation error")
+			e.Cause = ""
+		}
 
-	case errors.Is(err, enforcer.ErrConflict):
-		writeOut(wr, req, http.StatusConflict, err)
+	case errors.Is(e, enforcer.ErrUnsupported):
+		kindStatus = http.StatusNotImplemented
 
 	default:
-		writeOut(wr, req, http.StatusInternalServerError,
-			enforcer.ErrInternal.WithCausef(err.Error()))
+		log.Error().
+			Str("request_id", middleware.GetReqID(req.Context())).
+			Err(err).
+			Msg("request failed with internal error")
+
+		if !isDebug(req.Context()) {
+			e = enforcer.ErrInternal
+		} else if !errors.Is(e, enforcer.ErrInternal) {
+			// errors with unknown codes are reported as internal errors.
+			e = enforcer.ErrInternal.WithCausef("%v", e)
+		}
 	}
+
+	if status == 0 {
+		status = kindStatus
+	}
+
+	writeOut(wr, req, status, errorBody{
+		Error:     e,
+		RequestID: middleware.GetReqID(req.Context()),
+	})
 }
 
 func writeOut(wr http.ResponseWriter, req *http.Request, status int, v ...interface{}) {
@@ -0,0 +1,113 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+)
+
+func TestWriteErr(t *testing.T) {
+	t.Parallel()
+
+	fields := []enforcer.FieldError{{Field: "actor_id", Rule: "required", Message: "must satisfy 'required'"}}
+
+	table := []struct {
+		title     string
+		err       error
+		debug     bool
+		wantCode  int
+		wantBody  enforcer.Error
+		wantAuthz bool
+	}{
+		{
+			title:    "NotFound",
+			err:      enforcer.ErrNotFound.WithCausef("campaign 'foo' not found"),
+			wantCode: http.StatusNotFound,
+			wantBody: enforcer.ErrNotFound.WithCausef("campaign 'foo' not found"),
+		},
+		{
+			title:    "InvalidFields",
+			err:      enforcer.ErrInvalid.WithFields(fields...),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: enforcer.ErrInvalid.WithFields(fields...),
+		},
+		{
+			title:     "Unauthorized",
+			err:       enforcer.ErrUnauthorized,
+			wantCode:  http.StatusUnauthorized,
+			wantBody:  enforcer.ErrUnauthorized,
+			wantAuthz: true,
+		},
+		{
+			title:    "Forbidden",
+			err:      enforcer.ErrForbidden,
+			wantCode: http.StatusForbidden,
+			wantBody: enforcer.ErrForbidden,
+		},
+		{
+			title:    "Unprocessable",
+			err:      enforcer.ErrUnprocessable.WithMsgf("step 0 of campaign 'foo' failed").WithCausef("unknown name actor.secret"),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: enforcer.ErrUnprocessable.WithMsgf("step 0 of campaign 'foo' failed"),
+		},
+		{
+			title:    "Unprocessable_Debug",
+			err:      enforcer.ErrUnprocessable.WithCausef("unknown name actor.secret"),
+			debug:    true,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: enforcer.ErrUnprocessable.WithCausef("unknown name actor.secret"),
+		},
+		{
+			title:    "Unsupported",
+			err:      fmt.Errorf("wrapped: %w", enforcer.ErrUnsupported),
+			wantCode: http.StatusNotImplemented,
+			wantBody: enforcer.ErrUnsupported,
+		},
+		{
+			title:    "Internal",
+			err:      errors.New("connection refused"),
+			wantCode: http.StatusInternalServerError,
+			wantBody: enforcer.ErrInternal,
+		},
+		{
+			title:    "Internal_Debug",
+			err:      errors.New("connection refused"),
+			debug:    true,
+			wantCode: http.StatusInternalServerError,
+			wantBody: enforcer.ErrInternal.WithCausef("connection refused"),
+		},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+			if tt.debug {
+				ctx = context.WithValue(ctx, debugCtxKey{}, true)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+			rec := httptest.NewRecorder()
+			writeErr(rec, req, tt.err)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, tt.wantAuthz, rec.Header().Get("WWW-Authenticate") != "")
+
+			var body errorBody
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			assert.Equal(t, tt.wantBody, body.Error)
+			assert.Equal(t, "req-1", body.RequestID)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Package ingest provides bulk ingestion of actions with bounded concurrency
+// while preserving the order of actions of every actor.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/spy16/enforcer"
+)
+
+// Ingester is implemented by enforcer.API.
+type Ingester interface {
+	Ingest(ctx context.Context, completeMulti bool, ac enforcer.Actor, act enforcer.Action) ([]enforcer.IngestResult, error)
+}
+
+const queueSize = 16
+
+// Result represents the outcome of ingesting an action.
+type Result struct {
+	Action  enforcer.Action
+	Results []enforcer.IngestResult
+	Err     error
+}
+
+// Runner ingests actions using a fixed number of workers. Actions of an
+// actor are always handled by the same worker in the order received, so
+// steps of an actor's enrolments progress in the order of the actions.
+type Runner struct {
+	API     Ingester
+	Actors  enforcer.ActorResolver
+	Workers int  // default: 8
+	Multi   bool // complete multiple steps with a single action.
+}
+
+// Run ingests the actions received until the channel is closed or the
+// context is cancelled. onDone is invoked (concurrently from the workers)
+// with the result of every action taken from the channel. Run returns once
+// all such actions are handled.
+func (r *Runner) Run(ctx context.Context, actions <-chan enforcer.Action, onDone func(Result)) error {
+	workers := r.Workers
+	if workers <= 0 {
+		workers = 8
+	}
+
+	var wg sync.WaitGroup
+	queues := make([]chan enforcer.Action, workers)
+	for i := range queues {
+		queues[i] = make(chan enforcer.Action, queueSize)
+
+		wg.Add(1)
+		go func(queue <-chan enforcer.Action) {
+			defer wg.Done()
+			for act := range queue {
+				onDone(r.ingest(ctx, act))
+			}
+		}(queues[i])
+	}
+
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case act, ok := <-actions:
+			if !ok {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				onDone(Result{Action: act, Err: ctx.Err()})
+				return ctx.Err()
+			case queues[Shard(act.ActorID, workers)] <- act:
+			}
+		}
+	}
+}
+
+func (r *Runner) ingest(ctx context.Context, act enforcer.Action) Result {
+	res := Result{Action: act}
+
+	ac, err := Resolve(ctx, r.Actors, act.ActorID)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	act.ActorID = ac.ID
+
+	res.Results, res.Err = r.API.Ingest(ctx, r.Multi, *ac, act)
+	return res
+}
+
+// Resolve resolves the actor of an action. An actor that does not exist makes
+// the action invalid (i.e., ErrInvalid is returned), while other failures
+// (e.g., a timeout of the profile service) retain their kind so that they
+// can be retried.
+func Resolve(ctx context.Context, actors enforcer.ActorResolver, actorID string) (*enforcer.Actor, error) {
+	ac, err := actors.Resolve(ctx, actorID)
+	if errors.Is(err, enforcer.ErrNotFound) {
+		return nil, enforcer.ErrInvalid.WithCausef("failed to resolve actor '%s': %v", actorID, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve actor '%s': %w", actorID, err)
+	}
+	return ac, nil
+}
+
+// Shard returns the shard (in range [0, n)) that actions of the actor must
+// be handled by.
+func Shard(actorID string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(actorID))
+	return int(h.Sum32() % uint32(n))
+}
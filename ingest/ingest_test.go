@@ -0,0 +1,121 @@
+package ingest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/ingest"
+)
+
+func TestRunner_Run(t *testing.T) {
+	t.Parallel()
+
+	api := &orderRecorder{seen: map[string][]string{}}
+	r := &ingest.Runner{
+		API:     api,
+		Actors:  enforcer.ActorResolverFunc(resolve),
+		Workers: 4,
+	}
+
+	const actors, perActor = 10, 20
+
+	actions := make(chan enforcer.Action)
+	go func() {
+		defer close(actions)
+		for i := 0; i < perActor; i++ {
+			for j := 0; j < actors; j++ {
+				actions <- enforcer.Action{
+					ID:      fmt.Sprintf("act_%02d", i),
+					ActorID: fmt.Sprintf("actor_%d", j),
+				}
+			}
+		}
+		actions <- enforcer.Action{ID: "act_x", ActorID: "unknown"}
+		actions <- enforcer.Action{ID: "act_y", ActorID: "unavailable"}
+	}()
+
+	var mu sync.Mutex
+	var results []ingest.Result
+	err := r.Run(context.Background(), actions, func(res ingest.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, res)
+	})
+	require.NoError(t, err)
+	require.Len(t, results, actors*perActor+2)
+
+	var failed []ingest.Result
+	for _, res := range results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	require.Len(t, failed, 2)
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Action.ID < failed[j].Action.ID })
+	assert.Equal(t, "act_x", failed[0].Action.ID)
+	assert.True(t, errors.Is(failed[0].Err, enforcer.ErrInvalid))
+	assert.Equal(t, "act_y", failed[1].Action.ID)
+	assert.True(t, errors.Is(failed[1].Err, enforcer.ErrInternal), "resolver failure must retain its kind")
+	assert.False(t, errors.Is(failed[1].Err, enforcer.ErrInvalid))
+
+	for actorID, ids := range api.seen {
+		require.Len(t, ids, perActor)
+		for i, id := range ids {
+			assert.Equalf(t, fmt.Sprintf("act_%02d", i), id, "actions of '%s' ingested out of order", actorID)
+		}
+	}
+}
+
+func TestRunner_Run_Cancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := &ingest.Runner{API: &orderRecorder{seen: map[string][]string{}}, Actors: enforcer.ActorResolverFunc(resolve)}
+	err := r.Run(ctx, make(chan enforcer.Action), func(res ingest.Result) {})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestShard(t *testing.T) {
+	t.Parallel()
+
+	for _, actorID := range []string{"", "actor_1", "actor_2"} {
+		shard := ingest.Shard(actorID, 4)
+		assert.True(t, shard >= 0 && shard < 4)
+		assert.Equal(t, shard, ingest.Shard(actorID, 4))
+	}
+}
+
+func resolve(_ context.Context, actorID string) (*enforcer.Actor, error) {
+	switch actorID {
+	case "unknown":
+		return nil, enforcer.ErrNotFound
+	case "unavailable":
+		return nil, enforcer.ErrInternal.WithCausef("profile service timed out")
+	}
+	return &enforcer.Actor{ID: actorID}, nil
+}
+
+type orderRecorder struct {
+	mu   sync.Mutex
+	seen map[string][]string
+}
+
+func (rec *orderRecorder) Ingest(_ context.Context, _ bool, ac enforcer.Actor, act enforcer.Action) ([]enforcer.IngestResult, error) {
+	time.Sleep(time.Duration(act.ID[len(act.ID)-1]%3) * time.Millisecond)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.seen[ac.ID] = append(rec.seen[ac.ID], act.ID)
+	return nil, nil
+}
@@ -0,0 +1,31 @@
+package enforcer
+
+// Candidate represents an active enrolment along with its campaign that
+// may be progressed by an action.
+type Candidate struct {
+	Enrolment Enrolment
+	Campaign  Campaign
+
+	// isNew is set if the enrolment is not stored yet (i.e., the actor
+	// will be auto-enrolled if the action progresses it).
+	isNew bool
+}
+
+// OrderFn should return true if candidate 'a' must be tried before 'b'
+// while ingesting an action.
+type OrderFn func(a, b Candidate) bool
+
+// DefaultOrder orders candidates by campaign priority (higher first), then
+// by the enrolment end time (earliest first) and finally by campaign ID to
+// keep the order deterministic.
+func DefaultOrder(a, b Candidate) bool {
+	if a.Campaign.Priority != b.Campaign.Priority {
+		return a.Campaign.Priority > b.Campaign.Priority
+	}
+
+	if !a.Enrolment.EndsAt.Equal(b.Enrolment.EndsAt) {
+		return a.Enrolment.EndsAt.Before(b.Enrolment.EndsAt)
+	}
+
+	return a.Campaign.ID < b.Campaign.ID
+}
@@ -0,0 +1,57 @@
+package enforcer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultOrder(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	cand := func(id string, priority int, endsAt time.Time) Candidate {
+		return Candidate{
+			Enrolment: Enrolment{CampaignID: id, EndsAt: endsAt},
+			Campaign:  Campaign{ID: id, Priority: priority},
+		}
+	}
+
+	table := []struct {
+		title string
+		a, b  Candidate
+		want  bool
+	}{
+		{
+			title: "HigherPriorityFirst",
+			a:     cand("b", 10, now.Add(2*time.Hour)),
+			b:     cand("a", 5, now.Add(1*time.Hour)),
+			want:  true,
+		},
+		{
+			title: "LowerPriorityLater",
+			a:     cand("a", 5, now),
+			b:     cand("b", 10, now),
+			want:  false,
+		},
+		{
+			title: "EarliestEndFirst",
+			a:     cand("b", 5, now.Add(1*time.Hour)),
+			b:     cand("a", 5, now.Add(2*time.Hour)),
+			want:  true,
+		},
+		{
+			title: "CampaignIDAsTieBreaker",
+			a:     cand("a", 5, now),
+			b:     cand("b", 5, now),
+			want:  true,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.want, DefaultOrder(tt.a, tt.b))
+		})
+	}
+}
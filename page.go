@@ -0,0 +1,180 @@
+package enforcer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Supported sort fields for listing campaigns and enrolments. Prefix the
+// field with '-' to sort in descending order (e.g., "-priority").
+const (
+	SortCreatedAt = "created_at"
+	SortPriority  = "priority"
+	SortEndAt     = "end_at"
+)
+
+// Page represents cursor-based pagination options. Zero Limit means no
+// limit. Cursor must be empty or a value returned by a previous listing.
+type Page struct {
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Cursor identifies the last item of a page. Items are ordered by Key
+// and then by ID.
+type Cursor struct {
+	Sort string `json:"s,omitempty"`
+	Key  int64  `json:"k,omitempty"`
+	ID   string `json:"id"`
+}
+
+// Encode returns the opaque string form of the cursor.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor decodes the string returned by Cursor.Encode(). Returns
+// ErrInvalid if the string is not a valid cursor for the sort order.
+func DecodeCursor(s, sortBy string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalid.WithMsgf("cursor is not valid").WithCausef("%v", err)
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalid.WithMsgf("cursor is not valid").WithCausef("%v", err)
+	} else if c.Sort != sortBy {
+		return nil, ErrInvalid.WithMsgf("cursor is not valid").
+			WithCausef("cursor is for sort '%s', not '%s'", c.Sort, sortBy)
+	}
+	return &c, nil
+}
+
+// ParseSort validates the sort string and returns the field name and the
+// direction. Empty sort defaults to ascending order of creation time.
+func ParseSort(sortBy string) (field string, desc bool, err error) {
+	field = strings.TrimPrefix(sortBy, "-")
+	desc = strings.HasPrefix(sortBy, "-")
+	switch field {
+	case "":
+		return SortCreatedAt, desc, nil
+
+	case SortCreatedAt, SortPriority, SortEndAt:
+		return field, desc, nil
+
+	default:
+		return "", false, ErrInvalid.WithMsgf("sort field '%s' is not valid", field).
+			WithCausef("must be one of %s, %s, %s", SortCreatedAt, SortPriority, SortEndAt)
+	}
+}
+
+// sortString returns the canonical form of the sort order.
+func sortString(field string, desc bool) string {
+	if desc {
+		return "-" + field
+	}
+	return field
+}
+
+// SortKey returns the value of the campaign for the sort field.
+func SortKey(c Campaign, field string) int64 {
+	switch field {
+	case SortPriority:
+		return int64(c.Priority)
+
+	case SortEndAt:
+		return c.EndAt.UnixNano()
+
+	default:
+		return c.CreatedAt.UnixNano()
+	}
+}
+
+// PaginateCampaigns orders the campaigns as per q.Sort and returns the page
+// of campaigns following q.Cursor and the cursor for the next page.
+func PaginateCampaigns(camps []Campaign, q Query) ([]Campaign, string, error) {
+	field, desc, err := ParseSort(q.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	idx, next, err := paginate(len(camps), sortString(field, desc), desc, q.Page, func(i int) Cursor {
+		return Cursor{Key: SortKey(camps[i], field), ID: camps[i].ID}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	res := make([]Campaign, 0, len(idx))
+	for _, i := range idx {
+		res = append(res, camps[i])
+	}
+	return res, next, nil
+}
+
+// PaginateEnrolments orders the enrolments by campaign ID and returns the
+// page of enrolments following p.Cursor and the cursor for the next page.
+func PaginateEnrolments(enrs []Enrolment, p Page) ([]Enrolment, string, error) {
+	idx, next, err := paginate(len(enrs), "", false, p, func(i int) Cursor {
+		return Cursor{ID: enrs[i].CampaignID}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	res := make([]Enrolment, 0, len(idx))
+	for _, i := range idx {
+		res = append(res, enrs[i])
+	}
+	return res, next, nil
+}
+
+// paginate orders 'n' items by the cursor returned by keyOf and returns the
+// indices of the items in the requested page along with the next cursor.
+func paginate(n int, sortBy string, desc bool, p Page, keyOf func(i int) Cursor) ([]int, string, error) {
+	if p.Limit < 0 {
+		return nil, "", ErrInvalid.WithMsgf("limit must not be negative")
+	}
+
+	var after *Cursor
+	if p.Cursor != "" {
+		c, err := DecodeCursor(p.Cursor, sortBy)
+		if err != nil {
+			return nil, "", err
+		}
+		after = c
+	}
+
+	keys := make([]Cursor, n)
+	idx := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		keys[i] = keyOf(i)
+		if after == nil || isAfter(keys[i], *after, desc) {
+			idx = append(idx, i)
+		}
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return isAfter(keys[idx[j]], keys[idx[i]], desc)
+	})
+
+	if p.Limit == 0 || len(idx) <= p.Limit {
+		return idx, "", nil
+	}
+
+	idx = idx[:p.Limit]
+	last := keys[idx[len(idx)-1]]
+	last.Sort = sortBy
+	return idx, last.Encode(), nil
+}
+
+// isAfter returns true if cursor 'c' comes after 'ref' in the order.
+func isAfter(c, ref Cursor, desc bool) bool {
+	if c.Key != ref.Key {
+		return (c.Key > ref.Key) != desc
+	}
+	return (c.ID > ref.ID) != desc && c.ID != ref.ID
+}
@@ -0,0 +1,85 @@
+// Package publisher provides simple enforcer.Publisher implementations.
+// See the webhook package for publishing events to HTTP endpoints.
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/spy16/enforcer"
+)
+
+var (
+	_ enforcer.Publisher = (*JSONL)(nil)
+	_ enforcer.Publisher = (*Memory)(nil)
+	_ enforcer.Publisher = Multi()
+)
+
+// NewJSONL returns a publisher that writes every event as a line of JSON
+// to the writer (e.g., os.Stdout or a file).
+func NewJSONL(w io.Writer) *JSONL {
+	return &JSONL{enc: json.NewEncoder(w)}
+}
+
+// JSONL publishes events as newline-delimited JSON.
+type JSONL struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (pub *JSONL) Publish(_ context.Context, events []enforcer.Event) error {
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+
+	for _, evt := range events {
+		if err := pub.enc.Encode(evt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Multi returns a publisher that publishes the events to all the given
+// publishers in order. Publishing stops at the first failure, so events may
+// be published more than once to the publishers before the failing one.
+func Multi(pubs ...enforcer.Publisher) enforcer.Publisher {
+	if len(pubs) == 1 {
+		return pubs[0]
+	}
+	return multi(pubs)
+}
+
+type multi []enforcer.Publisher
+
+func (m multi) Publish(ctx context.Context, events []enforcer.Event) error {
+	for _, pub := range m {
+		if err := pub.Publish(ctx, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Memory retains published events in memory. It is meant for tests.
+type Memory struct {
+	mu     sync.Mutex
+	events []enforcer.Event
+}
+
+func (pub *Memory) Publish(_ context.Context, events []enforcer.Event) error {
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+
+	pub.events = append(pub.events, events...)
+	return nil
+}
+
+// Events returns all the events published so far.
+func (pub *Memory) Events() []enforcer.Event {
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+
+	return append([]enforcer.Event(nil), pub.events...)
+}
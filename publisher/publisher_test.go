@@ -0,0 +1,60 @@
+package publisher_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/publisher"
+)
+
+func TestJSONL_Publish(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	pub := publisher.NewJSONL(&buf)
+
+	events := []enforcer.Event{
+		{ID: "evt_1", Type: enforcer.EventEnrolled, ActorID: "actor_1"},
+		{ID: "evt_2", Type: enforcer.EventStepCompleted, ActorID: "actor_1"},
+	}
+	require.NoError(t, pub.Publish(context.Background(), events))
+
+	var ids []string
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var evt enforcer.Event
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &evt))
+		ids = append(ids, evt.ID)
+	}
+	assert.Equal(t, []string{"evt_1", "evt_2"}, ids)
+}
+
+func TestMemory_Publish(t *testing.T) {
+	t.Parallel()
+
+	pub := &publisher.Memory{}
+	require.NoError(t, pub.Publish(context.Background(), []enforcer.Event{{ID: "evt_1"}}))
+	require.NoError(t, pub.Publish(context.Background(), []enforcer.Event{{ID: "evt_2"}}))
+
+	events := pub.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, "evt_2", events[1].ID)
+}
+
+func TestMulti_Publish(t *testing.T) {
+	t.Parallel()
+
+	pub1, pub2 := &publisher.Memory{}, &publisher.Memory{}
+	pub := publisher.Multi(pub1, pub2)
+	require.NoError(t, pub.Publish(context.Background(), []enforcer.Event{{ID: "evt_1"}}))
+
+	assert.Len(t, pub1.Events(), 1)
+	assert.Len(t, pub2.Events(), 1)
+}
@@ -0,0 +1,78 @@
+package enforcer
+
+import (
+	"context"
+	"time"
+)
+
+// Relay drains the events recorded in the outbox to the publisher. Events
+// are acknowledged (i.e., removed from the outbox) only after they are
+// published successfully, so every event is published at-least once.
+type Relay struct {
+	Outbox    Outbox
+	Publisher Publisher
+
+	// Interval is the time to wait before polling the outbox again once
+	// it is drained or publishing fails (default: 1s).
+	Interval time.Duration
+
+	// BatchSize is the maximum number of events published at a time
+	// (default: 100).
+	BatchSize int
+
+	// OnError (if set) is invoked when draining fails. Failed batches are
+	// retried after the Interval.
+	OnError func(err error)
+}
+
+// Run drains the outbox until the context is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 1 * time.Second
+	}
+
+	for {
+		n, err := r.Drain(ctx)
+		if err != nil && r.OnError != nil {
+			r.OnError(err)
+		}
+
+		if err != nil || n == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(interval):
+			}
+		} else if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Drain publishes one batch of pending events and returns the number of
+// events published.
+func (r *Relay) Drain(ctx context.Context) (int, error) {
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	events, err := r.Outbox.PendingEvents(ctx, batchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	if err := r.Publisher.Publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, len(events))
+	for i, evt := range events {
+		ids[i] = evt.ID
+	}
+	if err := r.Outbox.AckEvents(ctx, ids); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
@@ -0,0 +1,74 @@
+package enforcer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelay_Drain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	outbox := &fakeOutbox{pending: []Event{{ID: "evt_1"}, {ID: "evt_2"}, {ID: "evt_3"}}}
+	pub := &fakePublisher{err: errors.New("failed")}
+	relay := &Relay{Outbox: outbox, Publisher: pub, BatchSize: 2}
+
+	n, err := relay.Drain(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.Len(t, outbox.pending, 3, "events must not be acknowledged if publish fails")
+
+	pub.err = nil
+	n, err = relay.Drain(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []Event{{ID: "evt_3"}}, outbox.pending)
+
+	n, err = relay.Drain(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = relay.Drain(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Len(t, pub.published, 3)
+}
+
+type fakeOutbox struct {
+	pending []Event
+}
+
+func (ob *fakeOutbox) PendingEvents(_ context.Context, limit int) ([]Event, error) {
+	if limit > len(ob.pending) {
+		limit = len(ob.pending)
+	}
+	return append([]Event(nil), ob.pending[:limit]...), nil
+}
+
+func (ob *fakeOutbox) AckEvents(_ context.Context, ids []string) error {
+	var pending []Event
+	for _, evt := range ob.pending {
+		if !contains(ids, evt.ID) {
+			pending = append(pending, evt)
+		}
+	}
+	ob.pending = pending
+	return nil
+}
+
+type fakePublisher struct {
+	err       error
+	published []Event
+}
+
+func (pub *fakePublisher) Publish(_ context.Context, events []Event) error {
+	if pub.err != nil {
+		return pub.err
+	}
+	pub.published = append(pub.published, events...)
+	return nil
+}
@@ -0,0 +1,177 @@
+package resolver
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spy16/enforcer"
+)
+
+var _ enforcer.ActorResolver = (*Cached)(nil)
+
+// Cached caches the actors resolved by the underlying resolver for the TTL.
+// Concurrent lookups of an actor that is not cached are de-duplicated into
+// a single lookup. Least recently used actors are evicted once the cache
+// has MaxSize actors.
+//
+// The shared lookup is not cancelled with the context of the caller that
+// started it (so that the other callers are not failed by it) and is bound
+// by the Timeout instead. Every caller waits for it only until its own
+// context is done.
+type Cached struct {
+	Resolver enforcer.ActorResolver
+	TTL      time.Duration
+	MaxSize  int           // default: 10000
+	Timeout  time.Duration // default: 10s
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first.
+	entries map[string]*list.Element
+	calls   map[string]*call
+}
+
+type cacheEntry struct {
+	key       string
+	actor     enforcer.Actor
+	expiresAt time.Time
+}
+
+// call represents an in-flight lookup of an actor.
+type call struct {
+	done        chan struct{}
+	actor       *enforcer.Actor
+	err         error
+	invalidated bool
+}
+
+func (c *Cached) Resolve(ctx context.Context, actorID string) (*enforcer.Actor, error) {
+	c.mu.Lock()
+	if ac, found := c.get(actorID); found {
+		c.mu.Unlock()
+		return ac, nil
+	}
+
+	cl, inFlight := c.calls[actorID]
+	if !inFlight {
+		cl = &call{done: make(chan struct{})}
+		if c.calls == nil {
+			c.calls = map[string]*call{}
+		}
+		c.calls[actorID] = cl
+		go c.lookup(detached{ctx}, actorID, cl)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-cl.done:
+	}
+	if cl.err != nil {
+		return nil, cl.err
+	}
+	return cloneActor(*cl.actor), nil
+}
+
+// lookup resolves the actor for the call and caches it.
+func (c *Cached) lookup(ctx context.Context, actorID string, cl *call) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cl.actor, cl.err = c.Resolver.Resolve(ctx, actorID)
+
+	c.mu.Lock()
+	if c.calls[actorID] == cl {
+		delete(c.calls, actorID)
+	}
+	if cl.err == nil && !cl.invalidated {
+		c.put(actorID, *cl.actor)
+	}
+	c.mu.Unlock()
+	close(cl.done)
+}
+
+// Invalidate removes the actor from the cache. Lookups of the actor that
+// are in-flight are not cached.
+func (c *Cached) Invalidate(actorID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, found := c.entries[actorID]; found {
+		c.lru.Remove(el)
+		delete(c.entries, actorID)
+	}
+	if cl, inFlight := c.calls[actorID]; inFlight {
+		cl.invalidated = true
+		delete(c.calls, actorID)
+	}
+}
+
+// Len returns the number of actors cached.
+func (c *Cached) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *Cached) get(actorID string) (*enforcer.Actor, bool) {
+	el, found := c.entries[actorID]
+	if !found {
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.lru.Remove(el)
+		delete(c.entries, actorID)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	return cloneActor(entry.actor), true
+}
+
+func (c *Cached) put(actorID string, ac enforcer.Actor) {
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+		c.lru = list.New()
+	}
+
+	entry := &cacheEntry{key: actorID, actor: *cloneActor(ac), expiresAt: time.Now().Add(c.TTL)}
+	if el, found := c.entries[actorID]; found {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[actorID] = c.lru.PushFront(entry)
+
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = 10000
+	}
+	for c.lru.Len() > maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// detached carries the values of the parent context (e.g., request ID for
+// logs) without its deadline and cancellation.
+type detached struct{ context.Context }
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// cloneActor returns a copy of the actor so that the callers cannot modify
+// the cached attributes.
+func cloneActor(ac enforcer.Actor) *enforcer.Actor {
+	return &enforcer.Actor{ID: ac.ID, Attribs: copyAttribs(ac.Attribs)}
+}
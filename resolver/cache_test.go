@@ -0,0 +1,161 @@
+package resolver_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/resolver"
+)
+
+func TestCached_Resolve(t *testing.T) {
+	t.Parallel()
+
+	src := &countingResolver{}
+	cached := &resolver.Cached{Resolver: src, TTL: 50 * time.Millisecond}
+
+	for i := 0; i < 3; i++ {
+		ac, err := cached.Resolve(context.Background(), "actor_1")
+		require.NoError(t, err)
+		assert.Equal(t, "gold", ac.Attribs["tier"])
+		ac.Attribs["tier"] = "modified"
+	}
+	assert.Equal(t, int32(1), src.count())
+
+	time.Sleep(60 * time.Millisecond)
+	_, err := cached.Resolve(context.Background(), "actor_1")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), src.count(), "expired entry must be resolved again")
+}
+
+func TestCached_MaxSize(t *testing.T) {
+	t.Parallel()
+
+	src := &countingResolver{}
+	cached := &resolver.Cached{Resolver: src, TTL: time.Minute, MaxSize: 2}
+
+	for _, actorID := range []string{"actor_1", "actor_2", "actor_1", "actor_3"} {
+		_, err := cached.Resolve(context.Background(), actorID)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, cached.Len())
+	assert.Equal(t, int32(3), src.count())
+
+	_, err := cached.Resolve(context.Background(), "actor_1")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), src.count(), "recently used actor must be retained")
+
+	_, err = cached.Resolve(context.Background(), "actor_2")
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), src.count(), "least recently used actor must be evicted")
+}
+
+func TestCached_Singleflight(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	src := &countingResolver{wait: release}
+	cached := &resolver.Cached{Resolver: src, TTL: time.Minute}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ac, err := cached.Resolve(context.Background(), "actor_1")
+			assert.NoError(t, err)
+			assert.Equal(t, "actor_1", ac.ID)
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), src.count())
+}
+
+func TestCached_LeaderCancelled(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	src := &countingResolver{wait: release}
+	cached := &resolver.Cached{Resolver: src, TTL: time.Minute}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cached.Resolve(leaderCtx, "actor_1")
+		leaderErr <- err
+	}()
+	require.Eventually(t, func() bool { return src.count() == 1 }, time.Second, time.Millisecond)
+
+	waiterRes := make(chan *enforcer.Actor, 1)
+	go func() {
+		ac, err := cached.Resolve(context.Background(), "actor_1")
+		assert.NoError(t, err)
+		waiterRes <- ac
+	}()
+
+	// leader gives up (e.g., client disconnected) while the lookup is
+	// in-flight.
+	cancel()
+	assert.ErrorIs(t, <-leaderErr, context.Canceled)
+
+	close(release)
+	ac := <-waiterRes
+	require.NotNil(t, ac)
+	assert.Equal(t, "actor_1", ac.ID)
+	assert.Equal(t, int32(1), src.count(), "waiter must share the lookup")
+	assert.Equal(t, 1, cached.Len(), "result of the lookup must be cached")
+}
+
+func TestCached_Timeout(t *testing.T) {
+	t.Parallel()
+
+	src := &countingResolver{wait: make(chan struct{})}
+	cached := &resolver.Cached{Resolver: src, TTL: time.Minute, Timeout: 10 * time.Millisecond}
+
+	_, err := cached.Resolve(context.Background(), "actor_1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestCached_Invalidate(t *testing.T) {
+	t.Parallel()
+
+	src := &countingResolver{}
+	cached := &resolver.Cached{Resolver: src, TTL: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		_, err := cached.Resolve(context.Background(), "actor_1")
+		require.NoError(t, err)
+		cached.Invalidate("actor_1")
+	}
+	assert.Equal(t, int32(2), src.count())
+	assert.Equal(t, 0, cached.Len())
+	cached.Invalidate("unknown")
+}
+
+type countingResolver struct {
+	calls int32
+	wait  chan struct{}
+}
+
+func (cr *countingResolver) Resolve(ctx context.Context, actorID string) (*enforcer.Actor, error) {
+	atomic.AddInt32(&cr.calls, 1)
+	if cr.wait != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-cr.wait:
+		}
+	}
+	return &enforcer.Actor{ID: actorID, Attribs: map[string]interface{}{"tier": "gold"}}, nil
+}
+
+func (cr *countingResolver) count() int32 { return atomic.LoadInt32(&cr.calls) }
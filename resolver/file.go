@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/spy16/enforcer"
+)
+
+// Fallback is the key in the static file for attributes of actors that are
+// not listed in the file.
+const Fallback = "*"
+
+var _ enforcer.ActorResolver = (*Static)(nil)
+
+// LoadFile loads actors from a JSON or YAML (based on the extension) file
+// containing attributes of actors by ID. Attributes under the Fallback key
+// (if present) are used for the actors not listed in the file.
+//
+//	user:1:
+//	  segments: ["beta"]
+//	"*":
+//	  segments: []
+func LoadFile(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var actors map[string]map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &actors)
+	default:
+		err = json.Unmarshal(data, &actors)
+	}
+	if err != nil {
+		return nil, enforcer.ErrInvalid.WithCausef("failed to parse actors file '%s': %v", path, err)
+	}
+	return &Static{Actors: actors}, nil
+}
+
+// Static resolves actors from attributes of actors by ID.
+type Static struct {
+	Actors map[string]map[string]interface{}
+}
+
+func (st *Static) Resolve(_ context.Context, actorID string) (*enforcer.Actor, error) {
+	attribs, found := st.Actors[actorID]
+	if !found {
+		attribs, found = st.Actors[Fallback]
+		if !found {
+			return nil, enforcer.ErrNotFound.WithMsgf("actor '%s' not found", actorID)
+		}
+	}
+
+	// attribs are copied so that the callers cannot modify the source.
+	return &enforcer.Actor{ID: actorID, Attribs: copyAttribs(attribs)}, nil
+}
+
+func copyAttribs(attribs map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(attribs))
+	for k, v := range attribs {
+		res[k] = v
+	}
+	return res
+}
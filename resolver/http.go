@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spy16/enforcer"
+)
+
+var _ enforcer.ActorResolver = (*HTTP)(nil)
+
+// NewHTTP returns a resolver that fetches actors from a profile service.
+// The '{id}' placeholder in the URL template is replaced by the (escaped)
+// actor ID (e.g., "http://profiles/actors/{id}").
+func NewHTTP(urlTpl string, timeout time.Duration) *HTTP {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &HTTP{
+		URL:    urlTpl,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// HTTP resolves actors using a profile service. Service must respond to GET
+// requests with the actor JSON (i.e., '{"id": "...", "attribs": {...}}')
+// or with 404 if the actor does not exist.
+type HTTP struct {
+	URL     string
+	Client  *http.Client
+	Headers map[string]string
+}
+
+func (h *HTTP) Resolve(ctx context.Context, actorID string) (*enforcer.Actor, error) {
+	u := strings.ReplaceAll(h.URL, "{id}", url.PathEscape(actorID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, enforcer.ErrInternal.WithCausef("failed to fetch actor '%s': %v", actorID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, enforcer.ErrNotFound.WithMsgf("actor '%s' not found", actorID)
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, enforcer.ErrInternal.
+			WithCausef("profile service responded with status %d for actor '%s'", resp.StatusCode, actorID)
+	}
+
+	var ac enforcer.Actor
+	if err := json.NewDecoder(resp.Body).Decode(&ac); err != nil {
+		return nil, enforcer.ErrInternal.WithCausef("failed to decode actor '%s': %v", actorID, err)
+	}
+	if ac.ID == "" {
+		ac.ID = actorID
+	} else if ac.ID != actorID {
+		return nil, enforcer.ErrInternal.
+			WithCausef("profile service returned actor '%s' for '%s'", ac.ID, actorID)
+	}
+	return &ac, nil
+}
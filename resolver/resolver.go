@@ -0,0 +1,43 @@
+// Package resolver provides enforcer.ActorResolver implementations.
+package resolver
+
+import (
+	"context"
+
+	"github.com/spy16/enforcer"
+)
+
+var (
+	_ enforcer.ActorResolver = (*Supplied)(nil)
+	_ enforcer.ActorResolver = (*None)(nil)
+)
+
+type attribsCtxKey struct{}
+
+// WithAttribs returns a context carrying attributes of the actor supplied
+// by the client (e.g., in the request body). See Supplied.
+func WithAttribs(ctx context.Context, attribs map[string]interface{}) context.Context {
+	return context.WithValue(ctx, attribsCtxKey{}, attribs)
+}
+
+// Supplied resolves actors using the attributes supplied by the client and
+// carried in the context (see WithAttribs). Actor has no attributes if the
+// context does not carry any. Clients can claim any attributes with it, so
+// it must be used only with trusted clients.
+type Supplied struct{}
+
+func (Supplied) Resolve(ctx context.Context, actorID string) (*enforcer.Actor, error) {
+	attribs, _ := ctx.Value(attribsCtxKey{}).(map[string]interface{})
+	if attribs == nil {
+		attribs = map[string]interface{}{}
+	}
+	return &enforcer.Actor{ID: actorID, Attribs: attribs}, nil
+}
+
+// None resolves actors without any attributes. Attributes supplied by the
+// clients are ignored.
+type None struct{}
+
+func (None) Resolve(ctx context.Context, actorID string) (*enforcer.Actor, error) {
+	return &enforcer.Actor{ID: actorID, Attribs: map[string]interface{}{}}, nil
+}
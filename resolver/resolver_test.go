@@ -0,0 +1,110 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/resolver"
+)
+
+func TestSupplied_Resolve(t *testing.T) {
+	t.Parallel()
+
+	ctx := resolver.WithAttribs(context.Background(), map[string]interface{}{"tier": "gold"})
+	ac, err := resolver.Supplied{}.Resolve(ctx, "actor_1")
+	require.NoError(t, err)
+	assert.Equal(t, "actor_1", ac.ID)
+	assert.Equal(t, "gold", ac.Attribs["tier"])
+
+	ac, err = resolver.Supplied{}.Resolve(context.Background(), "actor_1")
+	require.NoError(t, err)
+	assert.Empty(t, ac.Attribs)
+}
+
+func TestNone_Resolve(t *testing.T) {
+	t.Parallel()
+
+	ctx := resolver.WithAttribs(context.Background(), map[string]interface{}{"tier": "gold"})
+	ac, err := resolver.None{}.Resolve(ctx, "actor_1")
+	require.NoError(t, err)
+	assert.Equal(t, "actor_1", ac.ID)
+	assert.Empty(t, ac.Attribs, "supplied attributes must be ignored")
+}
+
+func TestHTTP_Resolve(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/actors/user:1":
+			assert.Equal(t, "secret", req.Header.Get("Authorization"))
+			_, _ = wr.Write([]byte(`{"id": "user:1", "attribs": {"segments": ["beta"]}}`))
+		case "/actors/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/actors/broken":
+			wr.WriteHeader(http.StatusBadGateway)
+		default:
+			wr.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	h := resolver.NewHTTP(srv.URL+"/actors/{id}", 100*time.Millisecond)
+	h.Headers = map[string]string{"Authorization": "secret"}
+
+	ac, err := h.Resolve(context.Background(), "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, "user:1", ac.ID)
+	assert.Equal(t, []interface{}{"beta"}, ac.Attribs["segments"])
+
+	table := map[string]error{
+		"unknown": enforcer.ErrNotFound,
+		"broken":  enforcer.ErrInternal,
+		"slow":    enforcer.ErrInternal,
+	}
+	for actorID, wantErr := range table {
+		_, err := h.Resolve(context.Background(), actorID)
+		assert.Truef(t, errors.Is(err, wantErr), "wanted '%v' for '%s', got '%v'", wantErr, actorID, err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"actors.json": `{"user:1": {"segments": ["beta"]}, "*": {"segments": []}}`,
+		"actors.yaml": "user:1:\n  segments: [beta]\n\"*\":\n  segments: []\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		static, err := resolver.LoadFile(path)
+		require.NoError(t, err, name)
+
+		ac, err := static.Resolve(context.Background(), "user:1")
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"beta"}, ac.Attribs["segments"], name)
+
+		ac, err = static.Resolve(context.Background(), "user:2")
+		require.NoError(t, err)
+		assert.Equal(t, "user:2", ac.ID)
+		assert.Equal(t, []interface{}{}, ac.Attribs["segments"], name)
+	}
+
+	static := &resolver.Static{Actors: map[string]map[string]interface{}{}}
+	_, err := static.Resolve(context.Background(), "user:1")
+	assert.True(t, errors.Is(err, enforcer.ErrNotFound))
+}
@@ -0,0 +1,176 @@
+package enforcer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Revision represents a version of a campaign. Revisions of the versions
+// replaced by updates are immutable.
+type Revision struct {
+	Version   int       `json:"version"`
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Campaign  Campaign  `json:"campaign"`
+}
+
+// Change represents a difference in a field of the campaign definition
+// between two revisions. Field is the path of the field in the JSON form of
+// the campaign (e.g., 'steps[1]'). From or To is nil if the field was
+// added or removed.
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type authorCtxKey struct{}
+
+// WithAuthor returns a context that attributes the campaign changes made by
+// the API using it to the given author.
+func WithAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, authorCtxKey{}, author)
+}
+
+func authorOf(ctx context.Context) string {
+	author, _ := ctx.Value(authorCtxKey{}).(string)
+	return author
+}
+
+func revisionOf(c Campaign) Revision {
+	return Revision{
+		Version:   c.Version,
+		Author:    c.UpdatedBy,
+		CreatedAt: c.UpdatedAt,
+		Campaign:  c,
+	}
+}
+
+// restore replaces the definition of the campaign with the one from the
+// revision. Same restrictions as apply are enforced on changes to the
+// campaign if it is in use.
+func (c *Campaign) restore(rev Campaign, pinned bool) error {
+	isUsed := c.IsActive(time.Now()) && c.CurEnrolments > 0
+	activeEnrErr := ErrInvalid.WithCausef("%d active enrolments", c.CurEnrolments)
+
+	if isUsed {
+		switch {
+		case !rev.StartAt.Equal(c.StartAt), !rev.EndAt.Equal(c.EndAt):
+			return activeEnrErr.WithMsgf("start-date cannot be modified")
+
+		case rev.Deadline != c.Deadline:
+			return activeEnrErr.WithMsgf("deadline cannot be edited")
+
+		case rev.Eligibility != c.Eligibility:
+			return activeEnrErr.WithMsgf("eligibility rule cannot be edited")
+
+		case !pinned && !reflect.DeepEqual(rev.Steps, c.Steps):
+			return activeEnrErr.WithMsgf("steps cannot be edited")
+		}
+	}
+
+	if rev.MaxEnrolments != c.MaxEnrolments && rev.MaxEnrolments < c.CurEnrolments {
+		return activeEnrErr.WithMsgf("max-enrolments cannot be updated to lesser value")
+	}
+
+	// only the definition is restored. identity and the bookkeeping fields
+	// are retained.
+	rev.ID = c.ID
+	rev.Version = c.Version
+	rev.CreatedAt = c.CreatedAt
+	rev.UpdatedAt = c.UpdatedAt
+	rev.UpdatedBy = c.UpdatedBy
+	rev.CurEnrolments = c.CurEnrolments
+	*c = rev
+
+	return c.Validate()
+}
+
+// diffCampaigns returns the changes in the definition from one campaign to
+// the other.
+func diffCampaigns(from, to Campaign) ([]Change, error) {
+	fromVal, err := definitionOf(from)
+	if err != nil {
+		return nil, err
+	}
+	toVal, err := definitionOf(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	diffValues("", fromVal, toVal, &changes)
+	return changes, nil
+}
+
+// definitionOf returns the JSON form of the campaign without the fields that
+// change on every update.
+func definitionOf(c Campaign) (map[string]interface{}, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	delete(m, "version")
+	delete(m, "updated_at")
+	delete(m, "updated_by")
+	delete(m, "cur_enrolments")
+	return m, nil
+}
+
+func diffValues(path string, from, to interface{}, changes *[]Change) {
+	switch fromV := from.(type) {
+	case map[string]interface{}:
+		if toV, ok := to.(map[string]interface{}); ok {
+			keys := map[string]struct{}{}
+			for k := range fromV {
+				keys[k] = struct{}{}
+			}
+			for k := range toV {
+				keys[k] = struct{}{}
+			}
+
+			sorted := make([]string, 0, len(keys))
+			for k := range keys {
+				sorted = append(sorted, k)
+			}
+			sort.Strings(sorted)
+
+			for _, k := range sorted {
+				field := k
+				if path != "" {
+					field = path + "." + k
+				}
+				diffValues(field, fromV[k], toV[k], changes)
+			}
+			return
+		}
+
+	case []interface{}:
+		if toV, ok := to.([]interface{}); ok {
+			for i := 0; i < len(fromV) || i < len(toV); i++ {
+				var fromItem, toItem interface{}
+				if i < len(fromV) {
+					fromItem = fromV[i]
+				}
+				if i < len(toV) {
+					toItem = toV[i]
+				}
+				diffValues(fmt.Sprintf("%s[%d]", path, i), fromItem, toItem, changes)
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, Change{Field: path, From: from, To: to})
+	}
+}
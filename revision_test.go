@@ -0,0 +1,70 @@
+package enforcer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCampaigns(t *testing.T) {
+	t.Parallel()
+
+	base := Campaign{
+		ID:      "camp_1",
+		Version: 1,
+		Tags:    []string{"country:us"},
+		Steps:   []Step{{Rule: "event.type == 'PURCHASE'"}},
+	}
+
+	table := []struct {
+		title  string
+		update func(c *Campaign)
+		want   []Change
+	}{
+		{
+			title: "Bookkeeping",
+			update: func(c *Campaign) {
+				c.Version = 2
+				c.UpdatedAt = time.Now()
+				c.UpdatedBy = "bob"
+				c.CurEnrolments = 10
+			},
+			want: nil,
+		},
+		{
+			title: "StepRule",
+			update: func(c *Campaign) {
+				c.Steps = []Step{{Rule: "event.type == 'REVIEW'"}}
+			},
+			want: []Change{{Field: "steps[0]", From: "event.type == 'PURCHASE'", To: "event.type == 'REVIEW'"}},
+		},
+		{
+			title: "TagsAndPriority",
+			update: func(c *Campaign) {
+				c.Priority = 5
+				c.Tags = nil
+			},
+			want: []Change{
+				{Field: "priority", From: float64(0), To: float64(5)},
+				{Field: "tags", From: []interface{}{"country:us"}, To: nil},
+			},
+		},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			t.Parallel()
+
+			to := base
+			to.Steps = append([]Step(nil), base.Steps...)
+			tt.update(&to)
+
+			got, err := diffCampaigns(base, to)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package enforcer
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Supported reward types.
+const (
+	RewardPoints = "points"
+	RewardCoupon = "coupon"
+	RewardCustom = "custom"
+)
+
+// Reward represents an outcome granted to an actor by a campaign. Reward is
+// granted when the campaign is completed, or when the step is completed if
+// Step is set. Only the field corresponding to the Type is used (i.e., Points
+// for RewardPoints, Coupon for RewardCoupon and Data for RewardCustom).
+type Reward struct {
+	Type   string          `json:"type"`
+	Step   *int            `json:"step,omitempty"`
+	Points int64           `json:"points,omitempty"`
+	Coupon string          `json:"coupon,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// GrantedReward represents a reward that was granted to an actor as part of
+// an enrolment.
+type GrantedReward struct {
+	Reward
+	GrantedAt time.Time `json:"granted_at"`
+	ActionID  string    `json:"action_id"`
+}
+
+func (r *Reward) validate(id, totalSteps int) error {
+	r.Type = strings.TrimSpace(r.Type)
+	r.Coupon = strings.TrimSpace(r.Coupon)
+
+	switch r.Type {
+	case RewardPoints:
+		if r.Points <= 0 {
+			return ErrInvalid.WithMsgf("points of reward %d must be positive", id)
+		}
+
+	case RewardCoupon:
+		if r.Coupon == "" {
+			return ErrInvalid.WithMsgf("coupon of reward %d must not be empty", id)
+		}
+
+	case RewardCustom:
+		if len(r.Data) == 0 || !json.Valid(r.Data) {
+			return ErrInvalid.WithMsgf("data of reward %d must be valid JSON", id)
+		}
+
+	default:
+		return ErrInvalid.WithMsgf("type '%s' of reward %d is not valid", r.Type, id).
+			WithCausef("must be one of %s, %s, %s", RewardPoints, RewardCoupon, RewardCustom)
+	}
+
+	if r.Step != nil && (*r.Step < 0 || *r.Step >= totalSteps) {
+		return ErrInvalid.WithMsgf("step of reward %d must be in range [0, %d)", id, totalSteps)
+	}
+	return nil
+}
+
+// rewardsFor returns the rewards to be granted for completing the step. If
+// the enrolment is completed, campaign rewards are included.
+func (c Campaign) rewardsFor(stepID int, enr Enrolment) []Reward {
+	isDone := enr.TotalSteps == len(enr.CompletedSteps)
+
+	var res []Reward
+	for _, r := range c.Rewards {
+		if (r.Step != nil && *r.Step == stepID) || (r.Step == nil && isDone) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
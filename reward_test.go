@@ -0,0 +1,88 @@
+package enforcer
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReward_validate(t *testing.T) {
+	t.Parallel()
+
+	step := func(i int) *int { return &i }
+
+	table := []struct {
+		title   string
+		reward  Reward
+		wantErr error
+	}{
+		{
+			title:  "Points",
+			reward: Reward{Type: RewardPoints, Points: 100},
+		},
+		{
+			title:   "ZeroPoints",
+			reward:  Reward{Type: RewardPoints},
+			wantErr: ErrInvalid,
+		},
+		{
+			title:  "Coupon",
+			reward: Reward{Type: RewardCoupon, Coupon: "FREE100", Step: step(1)},
+		},
+		{
+			title:   "EmptyCoupon",
+			reward:  Reward{Type: RewardCoupon, Coupon: "  "},
+			wantErr: ErrInvalid,
+		},
+		{
+			title:  "Custom",
+			reward: Reward{Type: RewardCustom, Data: json.RawMessage(`{"badge":"gold"}`)},
+		},
+		{
+			title:   "InvalidCustomData",
+			reward:  Reward{Type: RewardCustom, Data: json.RawMessage(`{"badge":`)},
+			wantErr: ErrInvalid,
+		},
+		{
+			title:   "UnknownType",
+			reward:  Reward{Type: "cash"},
+			wantErr: ErrInvalid,
+		},
+		{
+			title:   "StepOutOfRange",
+			reward:  Reward{Type: RewardPoints, Points: 10, Step: step(2)},
+			wantErr: ErrInvalid,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			err := tt.reward.validate(0, 2)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCampaign_rewardsFor(t *testing.T) {
+	t.Parallel()
+
+	first := 0
+	camp := Campaign{
+		Rewards: []Reward{
+			{Type: RewardPoints, Points: 10, Step: &first},
+			{Type: RewardCoupon, Coupon: "DONE"},
+		},
+	}
+
+	enr := Enrolment{TotalSteps: 2, CompletedSteps: []StepResult{{StepID: 0}}}
+	assert.Equal(t, camp.Rewards[:1], camp.rewardsFor(0, enr))
+
+	enr.CompletedSteps = append(enr.CompletedSteps, StepResult{StepID: 1})
+	assert.Equal(t, camp.Rewards[1:], camp.rewardsFor(1, enr))
+}
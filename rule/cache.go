@@ -0,0 +1,66 @@
+package rule
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/antonmedv/expr/vm"
+)
+
+// lruCache is a size-bounded cache of compiled programs that evicts the
+// least-recently used entry when full.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	items   map[string]*list.Element
+	entries *list.List
+}
+
+type cacheEntry struct {
+	key  string
+	prog *vm.Program
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		items:   map[string]*list.Element{},
+		entries: list.New(),
+	}
+}
+
+func (c *lruCache) get(key string) (*vm.Program, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.items[key]
+	if !found {
+		return nil, false
+	}
+	c.entries.MoveToFront(el)
+	return el.Value.(*cacheEntry).prog, true
+}
+
+func (c *lruCache) put(key string, prog *vm.Program) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, found := c.items[key]; found {
+		el.Value.(*cacheEntry).prog = prog
+		c.entries.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.entries.PushFront(&cacheEntry{key: key, prog: prog})
+	for c.entries.Len() > c.size {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
@@ -2,42 +2,132 @@ package rule
 
 import (
 	"context"
-	"sync"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
 
 	"github.com/antonmedv/expr"
 	"github.com/antonmedv/expr/vm"
 )
 
+// DefaultCacheSize is the number of compiled rules retained by the engine
+// returned by New().
+const DefaultCacheSize = 1024
+
 // New returns a fully-initialised rule engine instance.
-func New() *Engine {
-	return &Engine{vm: &vm.VM{}}
+func New() *Engine { return NewWithCache(DefaultCacheSize) }
+
+// NewWithCache returns a rule engine that retains at most 'size' compiled
+// rules. Caching is disabled if size is not positive.
+func NewWithCache(size int) *Engine {
+	en := &Engine{}
+	if size > 0 {
+		en.cache = newLRUCache(size)
+	}
+	return en
 }
 
 // Engine represents a rule engine and provides function for executing
-// rules.
+// rules. Engine is safe for concurrent use.
 type Engine struct {
-	mu sync.Mutex
-	vm *vm.VM
+	// counters are kept first to ensure 64-bit alignment for atomic ops.
+	hits   uint64
+	misses uint64
+	cache  *lruCache
+}
+
+// Stats represents the compiled-program cache statistics of an engine.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+// HitRatio returns the fraction of lookups served from the cache.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
 }
 
 // Exec executes a rule with given data as env and returns true if the
 // result is truthy (non-nil and non-false).
 func (en *Engine) Exec(_ context.Context, rule string, data interface{}) (bool, error) {
-	en.mu.Lock()
-	defer en.mu.Unlock()
-
-	p, err := expr.Compile(rule, expr.Env(data))
+	p, err := en.compile(rule, data)
 	if err != nil {
 		return false, err
 	}
 
-	out, err := en.vm.Run(p, data)
+	// a fresh VM per execution keeps evaluation lock-free. VM does not
+	// reset its memory usage between runs, so it is not pooled.
+	out, err := vm.Run(p, data)
 	if err != nil {
 		return false, err
 	}
 	return isTruthy(out), nil
 }
 
+// Check compiles the rule against the shape of the given data without
+// executing it. Returned error contains the position info if the rule
+// is not valid.
+func (en *Engine) Check(_ context.Context, rule string, data interface{}) error {
+	_, err := en.compile(rule, data)
+	return err
+}
+
+// Stats returns the current cache statistics.
+func (en *Engine) Stats() Stats {
+	st := Stats{
+		Hits:   atomic.LoadUint64(&en.hits),
+		Misses: atomic.LoadUint64(&en.misses),
+	}
+	if en.cache != nil {
+		st.Size = en.cache.len()
+	}
+	return st
+}
+
+func (en *Engine) compile(rule string, data interface{}) (*vm.Program, error) {
+	if en.cache == nil {
+		atomic.AddUint64(&en.misses, 1)
+		return expr.Compile(rule, expr.Env(data))
+	}
+
+	key := cacheKey(rule, data)
+	if p, found := en.cache.get(key); found {
+		atomic.AddUint64(&en.hits, 1)
+		return p, nil
+	}
+	atomic.AddUint64(&en.misses, 1)
+
+	p, err := expr.Compile(rule, expr.Env(data))
+	if err != nil {
+		return nil, err
+	}
+	en.cache.put(key, p)
+	return p, nil
+}
+
+// cacheKey returns the key for caching the compiled rule. Compilation
+// depends on the env type and, for a map env, on the top-level keys
+// available. So they are made part of the key along with the rule text.
+func cacheKey(rule string, data interface{}) string {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Sprintf("%T\x00%s", data, rule)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",") + "\x00" + rule
+}
+
 func isTruthy(v interface{}) bool {
 	if b, ok := v.(bool); ok {
 		return b
@@ -1 +1,136 @@
 package rule
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Exec(t *testing.T) {
+	t.Parallel()
+
+	table := []struct {
+		title   string
+		rule    string
+		data    interface{}
+		want    bool
+		wantErr bool
+	}{
+		{
+			title: "True",
+			rule:  "event.type == 'PURCHASE'",
+			data:  map[string]interface{}{"event": map[string]interface{}{"type": "PURCHASE"}},
+			want:  true,
+		},
+		{
+			title: "False",
+			rule:  "event.type == 'PURCHASE'",
+			data:  map[string]interface{}{"event": map[string]interface{}{"type": "REVIEW"}},
+			want:  false,
+		},
+		{
+			title:   "UndefinedVariable",
+			rule:    "event.type == 'PURCHASE'",
+			data:    map[string]interface{}{"actor": map[string]interface{}{"id": "a"}},
+			wantErr: true,
+		},
+		{
+			title:   "SyntaxError",
+			rule:    "event.type = 'PURCHASE'",
+			data:    map[string]interface{}{"event": map[string]interface{}{}},
+			wantErr: true,
+		},
+		{
+			title: "NonBoolTruthy",
+			rule:  "event.type",
+			data:  map[string]interface{}{"event": map[string]interface{}{"type": "PURCHASE"}},
+			want:  true,
+		},
+	}
+
+	en := New()
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			got, err := en.Exec(context.Background(), tt.rule, tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEngine_Stats(t *testing.T) {
+	t.Parallel()
+
+	en := NewWithCache(2)
+	data := map[string]interface{}{"event": map[string]interface{}{"amount": 10}}
+
+	for i := 0; i < 3; i++ {
+		_, err := en.Exec(context.Background(), "event.amount > 5", data)
+		require.NoError(t, err)
+	}
+	_, err := en.Exec(context.Background(), "event.amount > 1", data)
+	require.NoError(t, err)
+	_, err = en.Exec(context.Background(), "event.amount > 2", data)
+	require.NoError(t, err)
+
+	st := en.Stats()
+	assert.Equal(t, uint64(2), st.Hits)
+	assert.Equal(t, uint64(3), st.Misses)
+	assert.Equal(t, 2, st.Size)
+	assert.InDelta(t, 0.4, st.HitRatio(), 0.0001)
+}
+
+func TestEngine_Exec_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	en := NewWithCache(4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			rule := fmt.Sprintf("event.amount >= %d", i%8)
+			data := map[string]interface{}{"event": map[string]interface{}{"amount": i}}
+			got, err := en.Exec(context.Background(), rule, data)
+			assert.NoError(t, err)
+			assert.True(t, got)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkEngine_Exec(b *testing.B) {
+	data := map[string]interface{}{
+		"actor": map[string]interface{}{"id": "actor_1"},
+		"event": map[string]interface{}{"type": "PURCHASE", "amount": 1200},
+	}
+	const rule = "event.type == 'PURCHASE' and event.amount >= 1000"
+
+	b.Run("NoCache", func(b *testing.B) {
+		en := NewWithCache(0)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = en.Exec(context.Background(), rule, data)
+			}
+		})
+	})
+
+	b.Run("Cached", func(b *testing.B) {
+		en := New()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = en.Exec(context.Background(), rule, data)
+			}
+		})
+	})
+}
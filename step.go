@@ -0,0 +1,139 @@
+package enforcer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported step aggregators.
+const (
+	AggregateCount    = "count"
+	AggregateSum      = "sum"
+	AggregateDistinct = "distinct"
+)
+
+// Step represents a rule that an actor needs to satisfy in a campaign. A
+// plain step (i.e., without Aggregate) is completed by a single action that
+// matches the Rule. An aggregated step is completed once the aggregate of
+// all matching actions reaches the Target:
+//
+//	count    - number of matching actions.
+//	sum      - sum of the numeric Field of matching actions.
+//	distinct - number of distinct values of the Field of matching actions.
+//
+// Field is a dot-separated path into the action data (e.g., "order.amount").
+// Plain steps are represented in JSON as just the rule string.
+type Step struct {
+	Rule      string  `json:"rule"`
+	Aggregate string  `json:"aggregate,omitempty"`
+	Field     string  `json:"field,omitempty"`
+	Target    float64 `json:"target,omitempty"`
+}
+
+// StepProgress represents the partial progress of an actor in an aggregated
+// step that is not completed yet.
+type StepProgress struct {
+	StepID    int       `json:"step_id"`
+	Value     float64   `json:"value"`
+	Distinct  []string  `json:"distinct,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MarshalJSON encodes plain steps as rule strings and aggregated steps as
+// objects.
+func (s Step) MarshalJSON() ([]byte, error) {
+	if s.Aggregate == "" {
+		return json.Marshal(s.Rule)
+	}
+
+	type step Step
+	return json.Marshal(step(s))
+}
+
+// UnmarshalJSON decodes a step from either a rule string or an object.
+func (s *Step) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '"' {
+		*s = Step{}
+		return json.Unmarshal(b, &s.Rule)
+	}
+
+	type step Step
+	var v step
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = Step(v)
+	return nil
+}
+
+func (s *Step) validate(id int) error {
+	s.Rule = strings.TrimSpace(s.Rule)
+	s.Aggregate = strings.TrimSpace(s.Aggregate)
+	s.Field = strings.TrimSpace(s.Field)
+	if s.Rule == "" {
+		return ErrInvalid.WithMsgf("step rule %d must not be empty", id)
+	}
+
+	switch s.Aggregate {
+	case "":
+		return nil
+
+	case AggregateCount:
+
+	case AggregateSum, AggregateDistinct:
+		if s.Field == "" {
+			return ErrInvalid.WithMsgf("step %d must have a field for '%s' aggregate", id, s.Aggregate)
+		}
+
+	default:
+		return ErrInvalid.WithMsgf("aggregate '%s' of step %d is not valid", s.Aggregate, id).
+			WithCausef("must be one of %s, %s, %s", AggregateCount, AggregateSum, AggregateDistinct)
+	}
+
+	if s.Target <= 0 {
+		return ErrInvalid.WithMsgf("target of step %d must be positive", id)
+	}
+	return nil
+}
+
+// accumulate adds the matching action to the progress. Returns false if the
+// action does not contribute to the aggregate (e.g., field is missing or a
+// value is repeated for distinct aggregate).
+func (s Step) accumulate(prog *StepProgress, act Action) bool {
+	switch s.Aggregate {
+	case AggregateCount:
+		prog.Value++
+
+	case AggregateSum:
+		v, found := lookup(act.Data, s.Field)
+		if !found {
+			return false
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return false
+		}
+		prog.Value += f
+
+	case AggregateDistinct:
+		v, found := lookup(act.Data, s.Field)
+		if !found || v == nil {
+			return false
+		}
+		key := fmt.Sprint(v)
+		if contains(prog.Distinct, key) {
+			return false
+		}
+		prog.Distinct = append(prog.Distinct, key)
+		prog.Value = float64(len(prog.Distinct))
+
+	default:
+		return false
+	}
+
+	prog.UpdatedAt = act.Time
+	return true
+}
@@ -0,0 +1,119 @@
+package enforcer
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStep_JSON(t *testing.T) {
+	t.Parallel()
+
+	const data = `["event.type == 'PURCHASE'",{"rule":"event.type == 'PURCHASE'","aggregate":"sum","field":"order.amount","target":5000}]`
+
+	var steps []Step
+	require.NoError(t, json.Unmarshal([]byte(data), &steps))
+	assert.Equal(t, []Step{
+		{Rule: "event.type == 'PURCHASE'"},
+		{Rule: "event.type == 'PURCHASE'", Aggregate: AggregateSum, Field: "order.amount", Target: 5000},
+	}, steps)
+
+	b, err := json.Marshal(steps)
+	require.NoError(t, err)
+	assert.JSONEq(t, data, string(b))
+}
+
+func TestStep_validate(t *testing.T) {
+	t.Parallel()
+
+	table := []struct {
+		title   string
+		step    Step
+		wantErr error
+	}{
+		{
+			title:   "EmptyRule",
+			step:    Step{Rule: "   "},
+			wantErr: ErrInvalid,
+		},
+		{
+			title: "Plain",
+			step:  Step{Rule: "event.type == 'PURCHASE'"},
+		},
+		{
+			title: "Count",
+			step:  Step{Rule: "true", Aggregate: AggregateCount, Target: 3},
+		},
+		{
+			title:   "UnknownAggregate",
+			step:    Step{Rule: "true", Aggregate: "avg", Field: "amount", Target: 3},
+			wantErr: ErrInvalid,
+		},
+		{
+			title:   "SumWithoutField",
+			step:    Step{Rule: "true", Aggregate: AggregateSum, Target: 3},
+			wantErr: ErrInvalid,
+		},
+		{
+			title:   "ZeroTarget",
+			step:    Step{Rule: "true", Aggregate: AggregateDistinct, Field: "store_id"},
+			wantErr: ErrInvalid,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			err := tt.step.validate(0)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestStep_accumulate(t *testing.T) {
+	t.Parallel()
+
+	actions := []Action{
+		{ID: "a1", Data: map[string]interface{}{"store": "s1", "order": map[string]interface{}{"amount": 100.0}}},
+		{ID: "a2", Data: map[string]interface{}{"store": "s1", "order": map[string]interface{}{"amount": 250}}},
+		{ID: "a3", Data: map[string]interface{}{"store": "s2"}},
+	}
+
+	table := []struct {
+		title string
+		step  Step
+		want  float64
+	}{
+		{
+			title: "Count",
+			step:  Step{Aggregate: AggregateCount},
+			want:  3,
+		},
+		{
+			title: "Sum",
+			step:  Step{Aggregate: AggregateSum, Field: "order.amount"},
+			want:  350,
+		},
+		{
+			title: "Distinct",
+			step:  Step{Aggregate: AggregateDistinct, Field: "store"},
+			want:  2,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			var prog StepProgress
+			for _, act := range actions {
+				tt.step.accumulate(&prog, act)
+			}
+			assert.Equal(t, tt.want, prog.Value)
+		})
+	}
+}
@@ -5,26 +5,115 @@ import (
 	"time"
 )
 
-// Store implementation provides storage layer for campaigns and enrolments.
+// Store implementation provides storage layer for campaigns, enrolments and
+// the outbox of lifecycle events.
 type Store interface {
 	CampaignStore
 	EnrolmentStore
+	Outbox
 }
 
 // CampaignStore implementation provides storage layer for campaigns.
 type CampaignStore interface {
 	GetCampaign(ctx context.Context, id string) (*Campaign, error)
-	ListCampaigns(ctx context.Context, q Query) ([]Campaign, error)
+
+	// ListCampaigns returns campaigns matching the query as defined by
+	// Query.Match, ordered and paginated as per q.Sort and q.Page (see
+	// PaginateCampaigns). Cursor for the next page is returned if there
+	// are more results. Stores that apply the query natively should
+	// implement CampaignFilterer to avoid redundant filtering by the API.
+	ListCampaigns(ctx context.Context, q Query) ([]Campaign, string, error)
 	CreateCampaign(ctx context.Context, camp Campaign) error
 	UpdateCampaign(ctx context.Context, id string, updateFn UpdateFn) (*Campaign, error)
-	DeleteCampaign(ctx context.Context, id string) error
+
+	// DeleteCampaign deletes the campaign if it exists. If version is
+	// non-zero, the campaign is deleted only if it is at that version
+	// (ErrConflict otherwise, see CheckVersion) and ErrNotFound is returned
+	// if it does not exist. The check and the delete must be atomic.
+	DeleteCampaign(ctx context.Context, id string, version int) error
 }
 
 // EnrolmentStore implementation provides storage layer for enrolments.
+// Enrolments are identified by actor ID, campaign ID and iteration.
 type EnrolmentStore interface {
+	// GetEnrolment returns the enrolment with the highest iteration for
+	// the actor and campaign.
 	GetEnrolment(ctx context.Context, actorID, campaignID string) (*Enrolment, error)
-	ListEnrolments(ctx context.Context, actorID string) ([]Enrolment, error)
-	UpsertEnrolment(ctx context.Context, enrolment Enrolment) error
+
+	// ListEnrolments returns the latest iteration of enrolments of the
+	// actor ordered by campaign ID and paginated as per p (see
+	// PaginateEnrolments). Cursor for the next page is returned if there
+	// are more results.
+	ListEnrolments(ctx context.Context, actorID string, p Page) ([]Enrolment, string, error)
+
+	// ListEnrolmentHistory returns all iterations of enrolments of the
+	// actor into the campaign in the order of iteration.
+	ListEnrolmentHistory(ctx context.Context, actorID, campaignID string) ([]Enrolment, error)
+
+	// UpsertEnrolment inserts or updates the enrolment. Enrolment with a
+	// new iteration may be inserted only if it immediately follows the
+	// latest existing iteration (ErrConflict must be returned otherwise).
+	// When the first iteration of the enrolment is inserted, the campaign's
+	// CurEnrolments must be checked against MaxEnrolments (if non-zero) and
+	// incremented atomically along with the insert. ErrLimitReached must be
+	// returned if the campaign has no more room for new enrolments.
+	// Events (if any) must be added to the outbox atomically with the
+	// enrolment write. Events with the ID of a pending event are ignored.
+	UpsertEnrolment(ctx context.Context, enrolment Enrolment, events ...Event) error
+}
+
+// Outbox implementation provides storage for lifecycle events that are yet
+// to be published. Events are recorded by UpsertEnrolment and are drained
+// by the Relay.
+type Outbox interface {
+	// PendingEvents returns at-most 'limit' events (all if limit <= 0) that
+	// are not yet acknowledged, in the order they were recorded.
+	PendingEvents(ctx context.Context, limit int) ([]Event, error)
+
+	// AckEvents removes the events with given IDs from the outbox. IDs
+	// that are not pending are ignored.
+	AckEvents(ctx context.Context, ids []string) error
+}
+
+// CampaignFilterer is an optional capability of a Store. FiltersCampaigns
+// must return true only if ListCampaigns fully honors the Query criteria.
+// Otherwise, the API lists all campaigns and paginates them after applying
+// the filters.
+type CampaignFilterer interface {
+	FiltersCampaigns() bool
+}
+
+// IngestLog is an optional capability of a Store. When the store implements
+// it, Ingest records the results for every processed action along with the
+// enrolment changes and returns the recorded results for an action that has
+// already been processed instead of progressing the enrolments again.
+type IngestLog interface {
+	// GetIngested returns the results recorded for the action. Returns
+	// ErrNotFound if the action was never processed for the actor.
+	GetIngested(ctx context.Context, actorID, actionID string) ([]IngestResult, error)
+
+	// CommitIngested records the results of processing the action and upserts
+	// the enrolments (with the same semantics as UpsertEnrolment) with the
+	// events, atomically. Returns ErrConflict if the action is recorded
+	// already or if any of the enrolments is not the next version of the
+	// stored one (see CheckEnrolmentVersion), in which case none of the
+	// changes must be made.
+	CommitIngested(ctx context.Context, actorID, actionID string, res []IngestResult, enrolments []Enrolment, events []Event) error
+}
+
+// RevisionStore is an optional capability of a Store for keeping the history
+// of campaigns. When the store implements it, UpdateCampaign must store the
+// campaign as it was before the update as a revision (atomically with the
+// update) if the update changes its Version. Revisions must be deleted along
+// with the campaign.
+type RevisionStore interface {
+	// ListRevisions returns the stored revisions of the campaign in the
+	// order of version.
+	ListRevisions(ctx context.Context, campaignID string) ([]Campaign, error)
+
+	// GetRevision returns the stored revision of the campaign with the
+	// given version. Returns ErrNotFound if there is no such revision.
+	GetRevision(ctx context.Context, campaignID string, version int) (*Campaign, error)
 }
 
 // UpdateFn typed func value is used by campaign store to update
@@ -34,7 +123,8 @@ type UpdateFn func(ctx context.Context, actual *Campaign) error
 
 // Query represents filtering options for listing campaigns.
 // Following criteria must be realised as:
-// 	`Include + (SearchIn AND OnlyActive AND HavingTags)`
+//
+//	`Include + (SearchIn AND OnlyActive AND HavingTags)`
 type Query struct {
 	// Include campaigns with given ids unconditionally (i.e., other
 	// filters do not apply to this).
@@ -48,38 +138,44 @@ type Query struct {
 	// OnlyActive signals to return only active campaigns.
 	OnlyActive bool `json:"only_active,omitempty"`
 
+	// OnlyAutoEnrol signals to return only campaigns with AutoEnrol set.
+	OnlyAutoEnrol bool `json:"only_auto_enrol,omitempty"`
+
 	// HavingTags returns only those campaigns that have all the
 	// given tags.
 	HavingTags []string `json:"having_tags,omitempty"`
+
+	// Sort decides the order of the results. See ParseSort().
+	Sort string `json:"sort,omitempty"`
+
+	// Page limits the results to a page following the cursor.
+	Page
 }
 
-func (q Query) filterCampaigns(arr []Campaign) []Campaign {
-	searchSet := map[string]struct{}{}
-	for _, id := range q.SearchIn {
-		searchSet[id] = struct{}{}
+// Match returns true if the campaign satisfies the query criteria relative
+// to the given timestamp.
+func (q Query) Match(c Campaign, at time.Time) bool {
+	if contains(q.Include, c.ID) {
+		return true
 	}
 
+	isMatch := !q.OnlyActive || c.IsActive(at)
+	isMatch = isMatch && (!q.OnlyAutoEnrol || c.AutoEnrol)
+	if len(q.SearchIn) > 0 {
+		isMatch = isMatch && contains(q.SearchIn, c.ID)
+	}
+	isMatch = isMatch && (len(q.HavingTags) == 0 || c.HasTags(q.HavingTags))
+	return isMatch
+}
+
+func (q Query) filterCampaigns(arr []Campaign) []Campaign {
+	now := time.Now()
+
 	var res []Campaign
 	for _, camp := range arr {
-		if q.matchQuery(camp) {
+		if q.Match(camp, now) {
 			res = append(res, camp)
 		}
 	}
 	return res
 }
-
-func (q Query) matchQuery(c Campaign) bool {
-	isMatch := !q.OnlyActive || c.IsActive(time.Now())
-	if len(q.SearchIn) > 0 {
-		found := false
-		for _, id := range q.SearchIn {
-			if id == c.ID {
-				found = true
-				break
-			}
-		}
-		isMatch = isMatch && found
-	}
-	isMatch = isMatch && (len(q.HavingTags) == 0 || c.HasTags(q.HavingTags))
-	return isMatch
-}
@@ -1 +1,59 @@
 package enforcer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery_Match(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	inactive := Campaign{
+		ID:      "inactive",
+		Tags:    []string{"country:us"},
+		Enabled: false,
+		StartAt: now.Add(-1 * time.Hour),
+		EndAt:   now.Add(1 * time.Hour),
+	}
+
+	table := []struct {
+		title string
+		query Query
+		want  bool
+	}{
+		{
+			title: "NoFilter",
+			query: Query{},
+			want:  true,
+		},
+		{
+			title: "OnlyActive",
+			query: Query{OnlyActive: true},
+			want:  false,
+		},
+		{
+			title: "NotInSearchSpace",
+			query: Query{SearchIn: []string{"foo"}},
+			want:  false,
+		},
+		{
+			title: "MissingTag",
+			query: Query{HavingTags: []string{"country:us", "team:test"}},
+			want:  false,
+		},
+		{
+			title: "Included",
+			query: Query{Include: []string{"inactive"}, OnlyActive: true, SearchIn: []string{"foo"}},
+			want:  true,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.query.Match(inactive, now))
+		})
+	}
+}
@@ -0,0 +1,476 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/spy16/enforcer"
+)
+
+var (
+	_ enforcer.Store            = (*Store)(nil)
+	_ enforcer.IngestLog        = (*Store)(nil)
+	_ enforcer.CampaignFilterer = (*Store)(nil)
+	_ enforcer.RevisionStore    = (*Store)(nil)
+)
+
+var (
+	campaignsBucket  = []byte("campaigns")
+	enrolmentsBucket = []byte("enrolments")
+	ingestedBucket   = []byte("ingested")
+	outboxBucket     = []byte("outbox")
+	outboxIDsBucket  = []byte("outbox_ids")
+	revisionsBucket  = []byte("revisions")
+)
+
+// Open opens (or creates) the bolt database file at the given path and
+// returns a store backed by it.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{campaignsBucket, enrolmentsBucket, ingestedBucket, outboxBucket, outboxIDsBucket, revisionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Store implements enforcer.Store using an embedded bbolt database file.
+// Enrolments and ingested actions are kept in a nested bucket per actor.
+// See enrolmentKey() for the keys of enrolments within the actor bucket.
+// Outbox events are keyed by a zero-padded sequence to keep them in order.
+type Store struct {
+	db *bolt.DB
+}
+
+// Close closes the underlying database file.
+func (st *Store) Close() error { return st.db.Close() }
+
+func (st *Store) GetCampaign(ctx context.Context, id string) (*enforcer.Campaign, error) {
+	var c *enforcer.Campaign
+	err := st.db.View(func(tx *bolt.Tx) error {
+		var err error
+		c, err = getCampaign(tx, id)
+		return err
+	})
+	return c, err
+}
+
+func (st *Store) ListCampaigns(ctx context.Context, q enforcer.Query) ([]enforcer.Campaign, string, error) {
+	now := time.Now()
+
+	var res []enforcer.Campaign
+	err := st.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(campaignsBucket).ForEach(func(_, v []byte) error {
+			var c enforcer.Campaign
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			if q.Match(c, now) {
+				res = append(res, c)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return enforcer.PaginateCampaigns(res, q)
+}
+
+// FiltersCampaigns returns true since ListCampaigns applies the query.
+func (st *Store) FiltersCampaigns() bool { return true }
+
+func (st *Store) CreateCampaign(ctx context.Context, c enforcer.Campaign) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(campaignsBucket).Get([]byte(c.ID)) != nil {
+			return enforcer.ErrConflict.WithMsgf("campaign with id '%s' already exists", c.ID)
+		}
+		return putJSON(tx.Bucket(campaignsBucket), c.ID, c)
+	})
+}
+
+func (st *Store) UpdateCampaign(ctx context.Context, id string, updateFn enforcer.UpdateFn) (*enforcer.Campaign, error) {
+	var c *enforcer.Campaign
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		c, err = getCampaign(tx, id)
+		if err != nil {
+			return err
+		}
+
+		prev := *c
+		if err := updateFn(ctx, c); err != nil {
+			return err
+		}
+		if c.Version != prev.Version {
+			if err := putJSON(tx.Bucket(revisionsBucket), revisionKey(id, prev.Version), prev); err != nil {
+				return err
+			}
+		}
+		return putJSON(tx.Bucket(campaignsBucket), id, *c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (st *Store) DeleteCampaign(ctx context.Context, id string, version int) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		if version != 0 {
+			c, err := getCampaign(tx, id)
+			if err != nil {
+				return err
+			} else if err := enforcer.CheckVersion(*c, version); err != nil {
+				return err
+			}
+		}
+
+		// keys are collected first since deleting while iterating with
+		// a cursor skips keys.
+		var keys [][]byte
+		prefix := []byte(id + ":")
+		c := tx.Bucket(revisionsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if err := tx.Bucket(revisionsBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(campaignsBucket).Delete([]byte(id))
+	})
+}
+
+func (st *Store) ListRevisions(ctx context.Context, campaignID string) ([]enforcer.Campaign, error) {
+	var res []enforcer.Campaign
+	err := st.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(campaignID + ":")
+		c := tx.Bucket(revisionsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var rev enforcer.Campaign
+			if err := json.Unmarshal(v, &rev); err != nil {
+				return err
+			}
+			res = append(res, rev)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (st *Store) GetRevision(ctx context.Context, campaignID string, version int) (*enforcer.Campaign, error) {
+	var rev *enforcer.Campaign
+	err := st.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(revisionsBucket).Get([]byte(revisionKey(campaignID, version)))
+		if v == nil {
+			return enforcer.ErrNotFound.WithMsgf("revision %d of campaign '%s' not found", version, campaignID)
+		}
+
+		rev = &enforcer.Campaign{}
+		return json.Unmarshal(v, rev)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+func (st *Store) GetEnrolment(ctx context.Context, actorID, campaignID string) (*enforcer.Enrolment, error) {
+	var enr *enforcer.Enrolment
+	err := st.db.View(func(tx *bolt.Tx) error {
+		history := getHistory(tx.Bucket(enrolmentsBucket).Bucket([]byte(actorID)), campaignID)
+		if len(history) == 0 {
+			return enforcer.ErrNotFound.
+				WithMsgf("enrolment for actor '%s' and campaign '%s'", actorID, campaignID)
+		}
+
+		enr = &enforcer.Enrolment{}
+		return json.Unmarshal(history[len(history)-1], enr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return enr, nil
+}
+
+func (st *Store) ListEnrolments(ctx context.Context, actorID string, p enforcer.Page) ([]enforcer.Enrolment, string, error) {
+	latest := map[string]enforcer.Enrolment{}
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(enrolmentsBucket).Bucket([]byte(actorID))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(_, v []byte) error {
+			var enr enforcer.Enrolment
+			if err := json.Unmarshal(v, &enr); err != nil {
+				return err
+			}
+			if cur, found := latest[enr.CampaignID]; !found || cur.Iteration < enr.Iteration {
+				latest[enr.CampaignID] = enr
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	res := make([]enforcer.Enrolment, 0, len(latest))
+	for _, enr := range latest {
+		res = append(res, enr)
+	}
+	return enforcer.PaginateEnrolments(res, p)
+}
+
+func (st *Store) ListEnrolmentHistory(ctx context.Context, actorID, campaignID string) ([]enforcer.Enrolment, error) {
+	var res []enforcer.Enrolment
+	err := st.db.View(func(tx *bolt.Tx) error {
+		for _, v := range getHistory(tx.Bucket(enrolmentsBucket).Bucket([]byte(actorID)), campaignID) {
+			var enr enforcer.Enrolment
+			if err := json.Unmarshal(v, &enr); err != nil {
+				return err
+			}
+			res = append(res, enr)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (st *Store) UpsertEnrolment(ctx context.Context, enr enforcer.Enrolment, events ...enforcer.Event) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		if err := upsertEnrolment(tx, enr); err != nil {
+			return err
+		}
+		return recordEvents(tx, events)
+	})
+}
+
+// recordEvents adds the events to the outbox. Events are keyed by sequence to
+// retain the order. ID to key index is maintained to ignore duplicates and
+// for acknowledging.
+func recordEvents(tx *bolt.Tx, events []enforcer.Event) error {
+	b, ids := tx.Bucket(outboxBucket), tx.Bucket(outboxIDsBucket)
+	for _, evt := range events {
+		if ids.Get([]byte(evt.ID)) != nil {
+			continue
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%020d", seq)
+		if err := putJSON(b, key, evt); err != nil {
+			return err
+		}
+		if err := ids.Put([]byte(evt.ID), []byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *Store) PendingEvents(ctx context.Context, limit int) ([]enforcer.Event, error) {
+	var res []enforcer.Event
+	err := st.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(outboxBucket).Cursor()
+		for k, v := c.First(); k != nil && (limit <= 0 || len(res) < limit); k, v = c.Next() {
+			var evt enforcer.Event
+			if err := json.Unmarshal(v, &evt); err != nil {
+				return err
+			}
+			res = append(res, evt)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (st *Store) AckEvents(ctx context.Context, ids []string) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b, idx := tx.Bucket(outboxBucket), tx.Bucket(outboxIDsBucket)
+		for _, id := range ids {
+			key := idx.Get([]byte(id))
+			if key == nil {
+				continue
+			}
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+			if err := idx.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (st *Store) GetIngested(ctx context.Context, actorID, actionID string) ([]enforcer.IngestResult, error) {
+	var res []enforcer.IngestResult
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ingestedBucket).Bucket([]byte(actorID))
+		if b == nil || b.Get([]byte(actionID)) == nil {
+			return enforcer.ErrNotFound.
+				WithMsgf("action '%s' of actor '%s' is not ingested", actionID, actorID)
+		}
+		return json.Unmarshal(b.Get([]byte(actionID)), &res)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (st *Store) CommitIngested(ctx context.Context, actorID, actionID string, res []enforcer.IngestResult, enrolments []enforcer.Enrolment, events []enforcer.Event) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(ingestedBucket).CreateBucketIfNotExists([]byte(actorID))
+		if err != nil {
+			return err
+		} else if b.Get([]byte(actionID)) != nil {
+			return enforcer.ErrConflict.
+				WithMsgf("action '%s' of actor '%s' is already ingested", actionID, actorID)
+		}
+
+		if err := putJSON(b, actionID, res); err != nil {
+			return err
+		}
+		for _, enr := range enrolments {
+			if err := checkEnrolmentVersion(tx, enr); err != nil {
+				return err
+			} else if err := upsertEnrolment(tx, enr); err != nil {
+				return err
+			}
+		}
+		return recordEvents(tx, events)
+	})
+}
+
+func upsertEnrolment(tx *bolt.Tx, enr enforcer.Enrolment) error {
+	b, err := tx.Bucket(enrolmentsBucket).CreateBucketIfNotExists([]byte(enr.ActorID))
+	if err != nil {
+		return err
+	}
+
+	key := enrolmentKey(enr.CampaignID, enr.Iteration)
+	count := len(getHistory(b, enr.CampaignID))
+	if enr.Iteration < count {
+		return putJSON(b, key, enr)
+	} else if enr.Iteration > count {
+		return enforcer.ErrConflict.
+			WithMsgf("iteration %d does not follow the latest iteration %d", enr.Iteration, count-1)
+	}
+
+	if enr.Iteration == 0 {
+		camp, err := getCampaign(tx, enr.CampaignID)
+		if errors.Is(err, enforcer.ErrNotFound) {
+			// campaign does not exist. nothing to count against.
+			return putJSON(b, key, enr)
+		} else if err != nil {
+			return err
+		}
+
+		if camp.MaxEnrolments > 0 && camp.CurEnrolments >= camp.MaxEnrolments {
+			return enforcer.ErrLimitReached.
+				WithCausef("campaign '%s' allows only %d enrolments", camp.ID, camp.MaxEnrolments)
+		}
+		camp.CurEnrolments++
+		if err := putJSON(tx.Bucket(campaignsBucket), camp.ID, *camp); err != nil {
+			return err
+		}
+	}
+
+	return putJSON(b, key, enr)
+}
+
+func checkEnrolmentVersion(tx *bolt.Tx, enr enforcer.Enrolment) error {
+	var stored *enforcer.Enrolment
+	if b := tx.Bucket(enrolmentsBucket).Bucket([]byte(enr.ActorID)); b != nil {
+		if v := b.Get([]byte(enrolmentKey(enr.CampaignID, enr.Iteration))); v != nil {
+			stored = &enforcer.Enrolment{}
+			if err := json.Unmarshal(v, stored); err != nil {
+				return err
+			}
+		}
+	}
+	return enforcer.CheckEnrolmentVersion(stored, enr)
+}
+
+// enrolmentKey returns the key of the enrolment within the actor bucket.
+// First iteration is keyed by campaign ID alone and the rest are suffixed
+// with the zero-padded iteration so that they sort in order.
+func enrolmentKey(campaignID string, iteration int) string {
+	if iteration == 0 {
+		return campaignID
+	}
+	return fmt.Sprintf("%s:%010d", campaignID, iteration)
+}
+
+// revisionKey returns the key of the campaign revision. Version is zero-padded
+// so that the revisions of a campaign sort in order.
+func revisionKey(campaignID string, version int) string {
+	return fmt.Sprintf("%s:%010d", campaignID, version)
+}
+
+// getHistory returns the enrolment values of all iterations in order.
+func getHistory(b *bolt.Bucket, campaignID string) [][]byte {
+	if b == nil {
+		return nil
+	}
+
+	first := b.Get([]byte(campaignID))
+	if first == nil {
+		return nil
+	}
+	res := [][]byte{first}
+
+	prefix := []byte(campaignID + ":")
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		res = append(res, v)
+	}
+	return res
+}
+
+func getCampaign(tx *bolt.Tx, id string) (*enforcer.Campaign, error) {
+	v := tx.Bucket(campaignsBucket).Get([]byte(id))
+	if v == nil {
+		return nil, enforcer.ErrNotFound
+	}
+
+	var c enforcer.Campaign
+	if err := json.Unmarshal(v, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func putJSON(b *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
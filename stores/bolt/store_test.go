@@ -0,0 +1,53 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/stores/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.RunSuite(t, func(t *testing.T) enforcer.Store {
+		st, err := Open(filepath.Join(t.TempDir(), "enforcer.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = st.Close() })
+		return st
+	})
+}
+
+func TestStore_Persistence(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "enforcer.db")
+
+	st, err := Open(file)
+	require.NoError(t, err)
+	require.NoError(t, st.CreateCampaign(ctx, storetest.Campaign("persisted")))
+	require.NoError(t, st.UpsertEnrolment(ctx, enforcer.Enrolment{ActorID: "actor_1", CampaignID: "persisted"}))
+
+	_, err = st.UpdateCampaign(ctx, "persisted", func(ctx context.Context, actual *enforcer.Campaign) error {
+		actual.Priority = 50
+		return enforcer.ErrInvalid
+	})
+	assert.True(t, errors.Is(err, enforcer.ErrInvalid))
+	require.NoError(t, st.Close())
+
+	st, err = Open(file)
+	require.NoError(t, err)
+	defer st.Close()
+
+	c, err := st.GetCampaign(ctx, "persisted")
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.Priority)
+	assert.Equal(t, 1, c.CurEnrolments)
+
+	enr, err := st.GetEnrolment(ctx, "actor_1", "persisted")
+	require.NoError(t, err)
+	assert.Equal(t, "persisted", enr.CampaignID)
+}
@@ -3,17 +3,26 @@ package inmem
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/spy16/enforcer"
 )
 
-var _ enforcer.Store = (*Store)(nil)
+var (
+	_ enforcer.Store            = (*Store)(nil)
+	_ enforcer.IngestLog        = (*Store)(nil)
+	_ enforcer.CampaignFilterer = (*Store)(nil)
+	_ enforcer.RevisionStore    = (*Store)(nil)
+)
 
 type Store struct {
 	mu         sync.RWMutex
 	nextID     int
 	campaigns  map[string]enforcer.Campaign
-	enrolments map[string]map[string]enforcer.Enrolment
+	revisions  map[string][]enforcer.Campaign
+	enrolments map[string]map[string][]enforcer.Enrolment
+	ingested   map[string]map[string][]enforcer.IngestResult
+	outbox     []enforcer.Event
 }
 
 func (mem *Store) GetCampaign(ctx context.Context, id string) (*enforcer.Campaign, error) {
@@ -27,18 +36,25 @@ func (mem *Store) GetCampaign(ctx context.Context, id string) (*enforcer.Campaig
 	return &c, nil
 }
 
-func (mem *Store) ListCampaigns(ctx context.Context, q enforcer.Query) ([]enforcer.Campaign, error) {
+func (mem *Store) ListCampaigns(ctx context.Context, q enforcer.Query) ([]enforcer.Campaign, string, error) {
 	mem.mu.RLock()
 	defer mem.mu.RUnlock()
 
+	now := time.Now()
+
 	var res []enforcer.Campaign
 	for _, c := range mem.campaigns {
-		res = append(res, c)
+		if q.Match(c, now) {
+			res = append(res, c)
+		}
 	}
 
-	return res, nil
+	return enforcer.PaginateCampaigns(res, q)
 }
 
+// FiltersCampaigns returns true since ListCampaigns applies the query.
+func (mem *Store) FiltersCampaigns() bool { return true }
+
 func (mem *Store) CreateCampaign(ctx context.Context, c enforcer.Campaign) error {
 	mem.mu.Lock()
 	defer mem.mu.Unlock()
@@ -62,67 +78,245 @@ func (mem *Store) UpdateCampaign(ctx context.Context, id string, updateFn enforc
 		return nil, enforcer.ErrNotFound
 	}
 
+	prev := c
 	if err := updateFn(ctx, &c); err != nil {
 		return nil, err
 	}
+	if c.Version != prev.Version {
+		if mem.revisions == nil {
+			mem.revisions = map[string][]enforcer.Campaign{}
+		}
+		mem.revisions[id] = append(mem.revisions[id], prev)
+	}
 	mem.campaigns[id] = c
 
 	return &c, nil
 }
 
-func (mem *Store) DeleteCampaign(ctx context.Context, id string) error {
-	if len(mem.campaigns) == 0 {
-		return nil
-	}
-
+func (mem *Store) DeleteCampaign(ctx context.Context, id string, version int) error {
 	mem.mu.Lock()
 	defer mem.mu.Unlock()
 
+	if version != 0 {
+		c, found := mem.campaigns[id]
+		if !found {
+			return enforcer.ErrNotFound
+		} else if err := enforcer.CheckVersion(c, version); err != nil {
+			return err
+		}
+	}
+
 	delete(mem.campaigns, id)
+	delete(mem.revisions, id)
 	return nil
 }
 
+func (mem *Store) ListRevisions(ctx context.Context, campaignID string) ([]enforcer.Campaign, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	return append([]enforcer.Campaign(nil), mem.revisions[campaignID]...), nil
+}
+
+func (mem *Store) GetRevision(ctx context.Context, campaignID string, version int) (*enforcer.Campaign, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	for _, c := range mem.revisions[campaignID] {
+		if c.Version == version {
+			return &c, nil
+		}
+	}
+	return nil, enforcer.ErrNotFound.WithMsgf("revision %d of campaign '%s' not found", version, campaignID)
+}
+
 func (mem *Store) GetEnrolment(ctx context.Context, actorID, campaignID string) (*enforcer.Enrolment, error) {
 	mem.mu.RLock()
 	defer mem.mu.RUnlock()
 
-	e, found := mem.enrolments[actorID][campaignID]
-	if !found {
+	history := mem.enrolments[actorID][campaignID]
+	if len(history) == 0 {
 		return nil, enforcer.ErrNotFound.
 			WithMsgf("enrolment for actor '%s' and campaign '%s'", actorID, campaignID)
 	}
+	e := history[len(history)-1]
 	return &e, nil
 }
 
-func (mem *Store) ListEnrolments(ctx context.Context, actorID string) ([]enforcer.Enrolment, error) {
+func (mem *Store) ListEnrolments(ctx context.Context, actorID string, p enforcer.Page) ([]enforcer.Enrolment, string, error) {
 	mem.mu.RLock()
 	defer mem.mu.RUnlock()
 
 	var res []enforcer.Enrolment
-	for _, enr := range mem.enrolments[actorID] {
-		res = append(res, enr)
+	for _, history := range mem.enrolments[actorID] {
+		res = append(res, history[len(history)-1])
+	}
+	return enforcer.PaginateEnrolments(res, p)
+}
+
+func (mem *Store) ListEnrolmentHistory(ctx context.Context, actorID, campaignID string) ([]enforcer.Enrolment, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	return append([]enforcer.Enrolment(nil), mem.enrolments[actorID][campaignID]...), nil
+}
+
+func (mem *Store) UpsertEnrolment(ctx context.Context, enr enforcer.Enrolment, events ...enforcer.Event) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if err := mem.upsert(enr); err != nil {
+		return err
+	}
+	mem.record(events)
+	return nil
+}
+
+// upsert writes the enrolment. mu must be held for writing.
+func (mem *Store) upsert(enr enforcer.Enrolment) error {
+	history := mem.enrolments[enr.ActorID][enr.CampaignID]
+	if enr.Iteration < len(history) {
+		history[enr.Iteration] = enr
+		return nil
+	} else if enr.Iteration > len(history) {
+		return enforcer.ErrConflict.
+			WithMsgf("iteration %d does not follow the latest iteration %d", enr.Iteration, len(history)-1)
+	}
+
+	if enr.Iteration == 0 {
+		if camp, exists := mem.campaigns[enr.CampaignID]; exists {
+			if camp.MaxEnrolments > 0 && camp.CurEnrolments >= camp.MaxEnrolments {
+				return enforcer.ErrLimitReached.
+					WithCausef("campaign '%s' allows only %d enrolments", camp.ID, camp.MaxEnrolments)
+			}
+			camp.CurEnrolments++
+			mem.campaigns[enr.CampaignID] = camp
+		}
+	}
+
+	if mem.enrolments == nil {
+		mem.enrolments = map[string]map[string][]enforcer.Enrolment{}
+	}
+	if _, found := mem.enrolments[enr.ActorID]; !found {
+		mem.enrolments[enr.ActorID] = map[string][]enforcer.Enrolment{}
+	}
+	mem.enrolments[enr.ActorID][enr.CampaignID] = append(history, enr)
+	return nil
+}
+
+// record appends the events to the outbox ignoring the ones already
+// pending.
+func (mem *Store) record(events []enforcer.Event) {
+	for _, evt := range events {
+		pending := false
+		for _, existing := range mem.outbox {
+			if existing.ID == evt.ID {
+				pending = true
+				break
+			}
+		}
+		if !pending {
+			mem.outbox = append(mem.outbox, evt)
+		}
+	}
+}
+
+func (mem *Store) PendingEvents(ctx context.Context, limit int) ([]enforcer.Event, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	if limit <= 0 || limit > len(mem.outbox) {
+		limit = len(mem.outbox)
 	}
-	return res, nil
+	return append([]enforcer.Event(nil), mem.outbox[:limit]...), nil
 }
 
-func (mem *Store) UpsertEnrolment(ctx context.Context, enr enforcer.Enrolment) error {
+func (mem *Store) AckEvents(ctx context.Context, ids []string) error {
 	mem.mu.Lock()
 	defer mem.mu.Unlock()
 
-	_, found := mem.enrolments[enr.ActorID][enr.CampaignID]
+	acked := map[string]struct{}{}
+	for _, id := range ids {
+		acked[id] = struct{}{}
+	}
+
+	var pending []enforcer.Event
+	for _, evt := range mem.outbox {
+		if _, found := acked[evt.ID]; !found {
+			pending = append(pending, evt)
+		}
+	}
+	mem.outbox = pending
+	return nil
+}
+
+func (mem *Store) GetIngested(ctx context.Context, actorID, actionID string) ([]enforcer.IngestResult, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	res, found := mem.ingested[actorID][actionID]
 	if !found {
-		if mem.enrolments == nil {
-			mem.enrolments = map[string]map[string]enforcer.Enrolment{}
+		return nil, enforcer.ErrNotFound.
+			WithMsgf("action '%s' of actor '%s' is not ingested", actionID, actorID)
+	}
+	return append([]enforcer.IngestResult(nil), res...), nil
+}
+
+func (mem *Store) CommitIngested(ctx context.Context, actorID, actionID string, res []enforcer.IngestResult, enrolments []enforcer.Enrolment, events []enforcer.Event) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if _, found := mem.ingested[actorID][actionID]; found {
+		return enforcer.ErrConflict.
+			WithMsgf("action '%s' of actor '%s' is already ingested", actionID, actorID)
+	}
+
+	for _, enr := range enrolments {
+		var stored *enforcer.Enrolment
+		if history := mem.enrolments[enr.ActorID][enr.CampaignID]; enr.Iteration < len(history) {
+			stored = &history[enr.Iteration]
+		}
+		if err := enforcer.CheckEnrolmentVersion(stored, enr); err != nil {
+			return err
+		}
+	}
+
+	// the state touched by the enrolments is saved so that a failed commit
+	// leaves no partial writes behind.
+	histories := map[string][]enforcer.Enrolment{}
+	campaigns := map[string]enforcer.Campaign{}
+	for _, enr := range enrolments {
+		if _, saved := histories[enr.CampaignID]; !saved {
+			histories[enr.CampaignID] = append([]enforcer.Enrolment(nil), mem.enrolments[enr.ActorID][enr.CampaignID]...)
 		}
-		if _, found := mem.enrolments[enr.ActorID]; !found {
-			mem.enrolments[enr.ActorID] = map[string]enforcer.Enrolment{}
+		if camp, exists := mem.campaigns[enr.CampaignID]; exists {
+			campaigns[camp.ID] = camp
 		}
+	}
 
-		camp := mem.campaigns[enr.CampaignID]
-		camp.CurEnrolments++
-		mem.campaigns[enr.CampaignID] = camp
+	for _, enr := range enrolments {
+		if err := mem.upsert(enr); err != nil {
+			for campID, history := range histories {
+				if len(history) == 0 {
+					delete(mem.enrolments[actorID], campID)
+				} else {
+					mem.enrolments[actorID][campID] = history
+				}
+			}
+			for id, camp := range campaigns {
+				mem.campaigns[id] = camp
+			}
+			return err
+		}
 	}
+	mem.record(events)
 
-	mem.enrolments[enr.ActorID][enr.CampaignID] = enr
+	if mem.ingested == nil {
+		mem.ingested = map[string]map[string][]enforcer.IngestResult{}
+	}
+	if _, found := mem.ingested[actorID]; !found {
+		mem.ingested[actorID] = map[string][]enforcer.IngestResult{}
+	}
+	mem.ingested[actorID][actionID] = append([]enforcer.IngestResult(nil), res...)
 	return nil
 }
@@ -0,0 +1,14 @@
+package inmem
+
+import (
+	"testing"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/stores/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.RunSuite(t, func(t *testing.T) enforcer.Store {
+		return &Store{}
+	})
+}
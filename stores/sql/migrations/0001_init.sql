@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS campaigns (
+    id             VARCHAR(255) PRIMARY KEY,
+    spec           TEXT         NOT NULL,
+    enabled        BOOLEAN      NOT NULL,
+    priority       INTEGER      NOT NULL,
+    start_at       BIGINT       NOT NULL,
+    end_at         BIGINT       NOT NULL,
+    created_at     BIGINT       NOT NULL,
+    cur_enrolments INTEGER      NOT NULL DEFAULT 0,
+    max_enrolments INTEGER      NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS campaign_tags (
+    campaign_id VARCHAR(255) NOT NULL,
+    tag         VARCHAR(255) NOT NULL,
+    PRIMARY KEY (campaign_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_campaign_tags_tag ON campaign_tags (tag);
+
+CREATE TABLE IF NOT EXISTS enrolments (
+    actor_id    VARCHAR(255) NOT NULL,
+    campaign_id VARCHAR(255) NOT NULL,
+    spec        TEXT         NOT NULL,
+    PRIMARY KEY (actor_id, campaign_id)
+);
+
+CREATE TABLE IF NOT EXISTS ingested_actions (
+    actor_id  VARCHAR(255) NOT NULL,
+    action_id VARCHAR(255) NOT NULL,
+    results   TEXT         NOT NULL,
+    PRIMARY KEY (actor_id, action_id)
+);
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS idx_campaigns_created_at ON campaigns (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_campaigns_priority ON campaigns (priority, id);
+CREATE INDEX IF NOT EXISTS idx_campaigns_end_at ON campaigns (end_at, id);
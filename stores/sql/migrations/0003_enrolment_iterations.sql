@@ -0,0 +1,14 @@
+CREATE TABLE enrolments_v2 (
+    actor_id    VARCHAR(255) NOT NULL,
+    campaign_id VARCHAR(255) NOT NULL,
+    iteration   INTEGER      NOT NULL DEFAULT 0,
+    spec        TEXT         NOT NULL,
+    PRIMARY KEY (actor_id, campaign_id, iteration)
+);
+
+INSERT INTO enrolments_v2 (actor_id, campaign_id, iteration, spec)
+SELECT actor_id, campaign_id, 0, spec FROM enrolments;
+
+DROP TABLE enrolments;
+
+ALTER TABLE enrolments_v2 RENAME TO enrolments;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id         VARCHAR(255) PRIMARY KEY,
+    created_at BIGINT       NOT NULL,
+    seq        INTEGER      NOT NULL,
+    event      TEXT         NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_order ON outbox (created_at, seq);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS campaign_revisions (
+    campaign_id VARCHAR(255) NOT NULL,
+    version     INTEGER      NOT NULL,
+    spec        TEXT         NOT NULL,
+    PRIMARY KEY (campaign_id, version)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE campaigns ADD COLUMN auto_enrol BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE campaigns SET auto_enrol = TRUE WHERE spec LIKE '%"auto_enrol":true%';
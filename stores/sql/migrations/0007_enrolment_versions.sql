@@ -0,0 +1 @@
+ALTER TABLE enrolments ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
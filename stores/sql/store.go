@@ -0,0 +1,738 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v4/stdlib" // postgres driver
+	_ "modernc.org/sqlite"             // sqlite driver
+
+	"github.com/spy16/enforcer"
+)
+
+// Supported SQL dialects.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+var (
+	_ enforcer.Store            = (*Store)(nil)
+	_ enforcer.IngestLog        = (*Store)(nil)
+	_ enforcer.CampaignFilterer = (*Store)(nil)
+	_ enforcer.RevisionStore    = (*Store)(nil)
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open connects to the database using the dialect and data-source name,
+// applies any pending migrations and returns the store. Dialect must be
+// either Postgres or SQLite.
+func Open(ctx context.Context, dialect, dsn string) (*Store, error) {
+	var driver string
+	switch dialect {
+	case Postgres:
+		driver = "pgx"
+	case SQLite:
+		driver = "sqlite"
+	default:
+		return nil, fmt.Errorf("unknown sql dialect: '%s'", dialect)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == SQLite {
+		// sqlite allows only a single writer at a time. serialising all
+		// access avoids SQLITE_BUSY errors with concurrent transactions.
+		db.SetMaxOpenConns(1)
+	}
+
+	st := &Store{db: db, dialect: dialect}
+	if err := st.migrate(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// Store implements enforcer.Store using a SQL database.
+type Store struct {
+	db      *sql.DB
+	dialect string
+}
+
+// Close closes the underlying database connections.
+func (st *Store) Close() error { return st.db.Close() }
+
+func (st *Store) migrate(ctx context.Context) error {
+	const createVersions = `CREATE TABLE IF NOT EXISTS schema_migrations (version VARCHAR(255) PRIMARY KEY)`
+	if _, err := st.db.ExecContext(ctx, createVersions); err != nil {
+		return err
+	}
+
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	for _, f := range files {
+		version := strings.TrimSuffix(f.Name(), ".sql")
+		script, err := migrations.ReadFile("migrations/" + f.Name())
+		if err != nil {
+			return err
+		}
+
+		err = st.withTx(ctx, func(tx *sql.Tx) error {
+			var applied int
+			row := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, version)
+			if err := row.Scan(&applied); err != nil {
+				return err
+			} else if applied > 0 {
+				return nil
+			}
+
+			if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration '%s' failed: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (st *Store) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *Store) GetCampaign(ctx context.Context, id string) (*enforcer.Campaign, error) {
+	return getCampaign(ctx, st.db, id, "")
+}
+
+func (st *Store) ListCampaigns(ctx context.Context, q enforcer.Query) ([]enforcer.Campaign, string, error) {
+	field, desc, err := enforcer.ParseSort(q.Sort)
+	if err != nil {
+		return nil, "", err
+	} else if q.Limit < 0 {
+		return nil, "", enforcer.ErrInvalid.WithMsgf("limit must not be negative")
+	}
+
+	sortBy, dir, cmp := field, "ASC", ">"
+	if desc {
+		sortBy, dir, cmp = "-"+field, "DESC", "<"
+	}
+
+	where, args := buildQuery(q, time.Now())
+	if q.Cursor != "" {
+		after, err := enforcer.DecodeCursor(q.Cursor, sortBy)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, after.Key, after.ID)
+		where = fmt.Sprintf("(%s) AND (%s %s $%d OR (%s = $%d AND id %s $%d))",
+			where, field, cmp, len(args)-1, field, len(args)-1, cmp, len(args))
+	}
+
+	query := fmt.Sprintf(`SELECT spec, cur_enrolments FROM campaigns WHERE %s ORDER BY %s %s, id %s`,
+		where, field, dir, dir)
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit+1)
+	}
+
+	rows, err := st.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var res []enforcer.Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		res = append(res, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if q.Limit == 0 || len(res) <= q.Limit {
+		return res, "", nil
+	}
+	res = res[:q.Limit]
+	last := res[len(res)-1]
+	next := enforcer.Cursor{Sort: sortBy, Key: enforcer.SortKey(last, field), ID: last.ID}
+	return res, next.Encode(), nil
+}
+
+// FiltersCampaigns returns true since ListCampaigns applies the query.
+func (st *Store) FiltersCampaigns() bool { return true }
+
+func (st *Store) CreateCampaign(ctx context.Context, c enforcer.Campaign) error {
+	spec, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return st.withTx(ctx, func(tx *sql.Tx) error {
+		const q = `INSERT INTO campaigns
+			(id, spec, enabled, priority, start_at, end_at, created_at, cur_enrolments, max_enrolments, auto_enrol)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (id) DO NOTHING`
+		res, err := tx.ExecContext(ctx, q, c.ID, string(spec), c.Enabled, c.Priority,
+			c.StartAt.UnixNano(), c.EndAt.UnixNano(), c.CreatedAt.UnixNano(),
+			c.CurEnrolments, c.MaxEnrolments, c.AutoEnrol)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return enforcer.ErrConflict.WithMsgf("campaign with id '%s' already exists", c.ID)
+		}
+		return setTags(ctx, tx, c.ID, c.Tags)
+	})
+}
+
+func (st *Store) UpdateCampaign(ctx context.Context, id string, updateFn enforcer.UpdateFn) (*enforcer.Campaign, error) {
+	lock := ""
+	if st.dialect == Postgres {
+		lock = "FOR UPDATE"
+	}
+
+	var updated *enforcer.Campaign
+	err := st.withTx(ctx, func(tx *sql.Tx) error {
+		c, err := getCampaign(ctx, tx, id, lock)
+		if err != nil {
+			return err
+		}
+
+		prev := *c
+		if err := updateFn(ctx, c); err != nil {
+			return err
+		}
+
+		if c.Version != prev.Version {
+			prevSpec, err := json.Marshal(prev)
+			if err != nil {
+				return err
+			}
+
+			const q = `INSERT INTO campaign_revisions (campaign_id, version, spec) VALUES ($1, $2, $3)`
+			if _, err := tx.ExecContext(ctx, q, id, prev.Version, string(prevSpec)); err != nil {
+				return err
+			}
+		}
+
+		spec, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+
+		const q = `UPDATE campaigns
+			SET spec = $2, enabled = $3, priority = $4, start_at = $5, end_at = $6, max_enrolments = $7,
+				auto_enrol = $8
+			WHERE id = $1`
+		_, err = tx.ExecContext(ctx, q, id, string(spec), c.Enabled, c.Priority,
+			c.StartAt.UnixNano(), c.EndAt.UnixNano(), c.MaxEnrolments, c.AutoEnrol)
+		if err != nil {
+			return err
+		}
+
+		updated = c
+		return setTags(ctx, tx, id, c.Tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (st *Store) DeleteCampaign(ctx context.Context, id string, version int) error {
+	lock := ""
+	if st.dialect == Postgres {
+		lock = "FOR UPDATE"
+	}
+
+	return st.withTx(ctx, func(tx *sql.Tx) error {
+		if version != 0 {
+			c, err := getCampaign(ctx, tx, id, lock)
+			if err != nil {
+				return err
+			} else if err := enforcer.CheckVersion(*c, version); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM campaign_tags WHERE campaign_id = $1`, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM campaign_revisions WHERE campaign_id = $1`, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM campaigns WHERE id = $1`, id)
+		return err
+	})
+}
+
+func (st *Store) ListRevisions(ctx context.Context, campaignID string) ([]enforcer.Campaign, error) {
+	const q = `SELECT spec FROM campaign_revisions WHERE campaign_id = $1 ORDER BY version`
+	rows, err := st.db.QueryContext(ctx, q, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []enforcer.Campaign
+	for rows.Next() {
+		var spec string
+		if err := rows.Scan(&spec); err != nil {
+			return nil, err
+		}
+
+		var c enforcer.Campaign
+		if err := json.Unmarshal([]byte(spec), &c); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+func (st *Store) GetRevision(ctx context.Context, campaignID string, version int) (*enforcer.Campaign, error) {
+	const q = `SELECT spec FROM campaign_revisions WHERE campaign_id = $1 AND version = $2`
+
+	var spec string
+	if err := st.db.QueryRowContext(ctx, q, campaignID, version).Scan(&spec); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, enforcer.ErrNotFound.WithMsgf("revision %d of campaign '%s' not found", version, campaignID)
+		}
+		return nil, err
+	}
+
+	var c enforcer.Campaign
+	if err := json.Unmarshal([]byte(spec), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (st *Store) GetEnrolment(ctx context.Context, actorID, campaignID string) (*enforcer.Enrolment, error) {
+	const q = `SELECT spec FROM enrolments WHERE actor_id = $1 AND campaign_id = $2
+		ORDER BY iteration DESC LIMIT 1`
+
+	var spec string
+	if err := st.db.QueryRowContext(ctx, q, actorID, campaignID).Scan(&spec); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, enforcer.ErrNotFound.
+				WithMsgf("enrolment for actor '%s' and campaign '%s'", actorID, campaignID)
+		}
+		return nil, err
+	}
+
+	var enr enforcer.Enrolment
+	if err := json.Unmarshal([]byte(spec), &enr); err != nil {
+		return nil, err
+	}
+	return &enr, nil
+}
+
+func (st *Store) ListEnrolments(ctx context.Context, actorID string, p enforcer.Page) ([]enforcer.Enrolment, string, error) {
+	if p.Limit < 0 {
+		return nil, "", enforcer.ErrInvalid.WithMsgf("limit must not be negative")
+	}
+
+	query := `SELECT spec FROM enrolments e WHERE actor_id = $1
+		AND iteration = (SELECT MAX(iteration) FROM enrolments l
+			WHERE l.actor_id = e.actor_id AND l.campaign_id = e.campaign_id)`
+	args := []interface{}{actorID}
+	if p.Cursor != "" {
+		after, err := enforcer.DecodeCursor(p.Cursor, "")
+		if err != nil {
+			return nil, "", err
+		}
+		query += ` AND campaign_id > $2`
+		args = append(args, after.ID)
+	}
+	query += ` ORDER BY campaign_id`
+	if p.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", p.Limit+1)
+	}
+
+	res, err := st.queryEnrolments(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if p.Limit == 0 || len(res) <= p.Limit {
+		return res, "", nil
+	}
+	res = res[:p.Limit]
+	next := enforcer.Cursor{ID: res[len(res)-1].CampaignID}
+	return res, next.Encode(), nil
+}
+
+func (st *Store) ListEnrolmentHistory(ctx context.Context, actorID, campaignID string) ([]enforcer.Enrolment, error) {
+	const q = `SELECT spec FROM enrolments WHERE actor_id = $1 AND campaign_id = $2 ORDER BY iteration`
+	return st.queryEnrolments(ctx, q, actorID, campaignID)
+}
+
+func (st *Store) UpsertEnrolment(ctx context.Context, enr enforcer.Enrolment, events ...enforcer.Event) error {
+	return st.withTx(ctx, func(tx *sql.Tx) error {
+		if err := upsertEnrolment(ctx, tx, enr, false); err != nil {
+			return err
+		}
+		return recordEvents(ctx, tx, events)
+	})
+}
+
+// recordEvents adds the events to the outbox ignoring the ones that are
+// already pending.
+func recordEvents(ctx context.Context, tx *sql.Tx, events []enforcer.Event) error {
+	now := time.Now().UnixNano()
+	for i, evt := range events {
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+
+		const q = `INSERT INTO outbox (id, created_at, seq, event) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (id) DO NOTHING`
+		if _, err := tx.ExecContext(ctx, q, evt.ID, now, i, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *Store) PendingEvents(ctx context.Context, limit int) ([]enforcer.Event, error) {
+	query := `SELECT event FROM outbox ORDER BY created_at, seq`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := st.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []enforcer.Event
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var evt enforcer.Event
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			return nil, err
+		}
+		res = append(res, evt)
+	}
+	return res, rows.Err()
+}
+
+func (st *Store) AckEvents(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var ph []string
+	for i := range ids {
+		ph = append(ph, fmt.Sprintf("$%d", i+1))
+	}
+	_, err := st.db.ExecContext(ctx, `DELETE FROM outbox WHERE id IN (`+strings.Join(ph, ", ")+`)`, toArgs(ids)...)
+	return err
+}
+
+// upsertEnrolment writes the enrolment. If checkVersion is set, ErrConflict
+// is returned unless the enrolment is the next version of the stored one.
+// Version is checked by the update itself so that concurrent writes of the
+// same version cannot both succeed.
+func upsertEnrolment(ctx context.Context, tx *sql.Tx, enr enforcer.Enrolment, checkVersion bool) error {
+	spec, err := json.Marshal(enr)
+	if err != nil {
+		return err
+	}
+
+	if enr.Iteration > 0 {
+		// iterations must be stored in order without gaps.
+		var latest int
+		const latestQ = `SELECT COALESCE(MAX(iteration), -1) FROM enrolments
+			WHERE actor_id = $1 AND campaign_id = $2`
+		if err := tx.QueryRowContext(ctx, latestQ, enr.ActorID, enr.CampaignID).Scan(&latest); err != nil {
+			return err
+		} else if latest < enr.Iteration-1 {
+			return enforcer.ErrConflict.
+				WithMsgf("iteration %d does not follow the latest iteration %d", enr.Iteration, latest)
+		}
+	}
+
+	const insertQ = `INSERT INTO enrolments (actor_id, campaign_id, iteration, version, spec) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (actor_id, campaign_id, iteration) DO NOTHING`
+	res, err := tx.ExecContext(ctx, insertQ, enr.ActorID, enr.CampaignID, enr.Iteration, enr.Version, string(spec))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		updateQ := `UPDATE enrolments SET version = $4, spec = $5
+			WHERE actor_id = $1 AND campaign_id = $2 AND iteration = $3`
+		args := []interface{}{enr.ActorID, enr.CampaignID, enr.Iteration, enr.Version, string(spec)}
+		if checkVersion {
+			updateQ += ` AND version = $6`
+			args = append(args, enr.Version-1)
+		}
+
+		res, err := tx.ExecContext(ctx, updateQ, args...)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 && checkVersion {
+			return enforcer.ErrConflict.
+				WithMsgf("enrolment of actor '%s' into campaign '%s' has been modified", enr.ActorID, enr.CampaignID).
+				WithCausef("version %d does not follow the current version", enr.Version)
+		}
+		return nil
+	} else if checkVersion && enr.Version != 1 {
+		return enforcer.CheckEnrolmentVersion(nil, enr)
+	} else if enr.Iteration > 0 {
+		// only the first iteration is counted against the campaign.
+		return nil
+	}
+
+	// new enrolment. count it against the campaign only if there is
+	// room for it.
+	const countQ = `UPDATE campaigns SET cur_enrolments = cur_enrolments + 1
+		WHERE id = $1 AND (max_enrolments = 0 OR cur_enrolments < max_enrolments)`
+	res, err = tx.ExecContext(ctx, countQ, enr.CampaignID)
+	if err != nil {
+		return err
+	} else if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return limitReached(ctx, tx, enr.CampaignID)
+	}
+	return nil
+}
+
+func (st *Store) GetIngested(ctx context.Context, actorID, actionID string) ([]enforcer.IngestResult, error) {
+	const q = `SELECT results FROM ingested_actions WHERE actor_id = $1 AND action_id = $2`
+
+	var results string
+	if err := st.db.QueryRowContext(ctx, q, actorID, actionID).Scan(&results); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, enforcer.ErrNotFound.
+				WithMsgf("action '%s' of actor '%s' is not ingested", actionID, actorID)
+		}
+		return nil, err
+	}
+
+	var res []enforcer.IngestResult
+	if err := json.Unmarshal([]byte(results), &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (st *Store) CommitIngested(ctx context.Context, actorID, actionID string, res []enforcer.IngestResult, enrolments []enforcer.Enrolment, events []enforcer.Event) error {
+	results, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	return st.withTx(ctx, func(tx *sql.Tx) error {
+		// the action is recorded first so that a concurrent commit of the
+		// same action waits on (and then fails due to) this one.
+		const q = `INSERT INTO ingested_actions (actor_id, action_id, results) VALUES ($1, $2, $3)
+			ON CONFLICT (actor_id, action_id) DO NOTHING`
+		if r, err := tx.ExecContext(ctx, q, actorID, actionID, string(results)); err != nil {
+			return err
+		} else if n, err := r.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return enforcer.ErrConflict.
+				WithMsgf("action '%s' of actor '%s' is already ingested", actionID, actorID)
+		}
+
+		for _, enr := range enrolments {
+			if err := upsertEnrolment(ctx, tx, enr, true); err != nil {
+				return err
+			}
+		}
+		return recordEvents(ctx, tx, events)
+	})
+}
+
+// buildQuery returns the where clause and its args realising the criteria
+// `Include + (SearchIn AND OnlyActive AND HavingTags)`.
+func buildQuery(q enforcer.Query, at time.Time) (string, []interface{}) {
+	var args []interface{}
+	placeholders := func(vals ...interface{}) string {
+		var ph []string
+		for _, v := range vals {
+			args = append(args, v)
+			ph = append(ph, fmt.Sprintf("$%d", len(args)))
+		}
+		return strings.Join(ph, ", ")
+	}
+
+	conds := []string{"1 = 1"}
+	if len(q.SearchIn) > 0 {
+		conds = append(conds, "id IN ("+placeholders(toArgs(q.SearchIn)...)+")")
+	}
+	if q.OnlyActive {
+		conds = append(conds, "enabled = "+placeholders(true))
+		conds = append(conds, "start_at < "+placeholders(at.UnixNano()))
+		conds = append(conds, "end_at > "+placeholders(at.UnixNano()))
+	}
+	if q.OnlyAutoEnrol {
+		conds = append(conds, "auto_enrol = "+placeholders(true))
+	}
+	if len(q.HavingTags) > 0 {
+		tags := cleanTags(q.HavingTags)
+		conds = append(conds, fmt.Sprintf(
+			"(SELECT COUNT(*) FROM campaign_tags t WHERE t.campaign_id = campaigns.id AND t.tag IN (%s)) = %s",
+			placeholders(toArgs(tags)...), placeholders(len(tags))))
+	}
+
+	where := "(" + strings.Join(conds, " AND ") + ")"
+	if len(q.Include) > 0 {
+		where = "id IN (" + placeholders(toArgs(q.Include)...) + ") OR " + where
+	}
+	return where, args
+}
+
+func toArgs(vals []string) []interface{} {
+	res := make([]interface{}, len(vals))
+	for i, v := range vals {
+		res[i] = v
+	}
+	return res
+}
+
+func cleanTags(tags []string) []string {
+	set := map[string]struct{}{}
+	var res []string
+	for _, tag := range tags {
+		if _, found := set[tag]; !found {
+			set[tag] = struct{}{}
+			res = append(res, tag)
+		}
+	}
+	return res
+}
+
+func (st *Store) queryEnrolments(ctx context.Context, query string, args ...interface{}) ([]enforcer.Enrolment, error) {
+	rows, err := st.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []enforcer.Enrolment
+	for rows.Next() {
+		var spec string
+		if err := rows.Scan(&spec); err != nil {
+			return nil, err
+		}
+
+		var enr enforcer.Enrolment
+		if err := json.Unmarshal([]byte(spec), &enr); err != nil {
+			return nil, err
+		}
+		res = append(res, enr)
+	}
+	return res, rows.Err()
+}
+
+// limitReached returns the error to be used when a new enrolment cannot be
+// counted against the campaign.
+func limitReached(ctx context.Context, tx *sql.Tx, campaignID string) error {
+	var maxEnrolments int
+	row := tx.QueryRowContext(ctx, `SELECT max_enrolments FROM campaigns WHERE id = $1`, campaignID)
+	if err := row.Scan(&maxEnrolments); err != nil {
+		if err == sql.ErrNoRows {
+			// campaign does not exist. nothing to count against.
+			return nil
+		}
+		return err
+	}
+	return enforcer.ErrLimitReached.
+		WithCausef("campaign '%s' allows only %d enrolments", campaignID, maxEnrolments)
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func getCampaign(ctx context.Context, db queryer, id, lock string) (*enforcer.Campaign, error) {
+	q := `SELECT spec, cur_enrolments FROM campaigns WHERE id = $1 ` + lock
+	c, err := scanCampaign(db.QueryRowContext(ctx, q, id))
+	if err == sql.ErrNoRows {
+		return nil, enforcer.ErrNotFound
+	}
+	return c, err
+}
+
+func scanCampaign(row scanner) (*enforcer.Campaign, error) {
+	var spec string
+	var curEnrolments int
+	if err := row.Scan(&spec, &curEnrolments); err != nil {
+		return nil, err
+	}
+
+	var c enforcer.Campaign
+	if err := json.Unmarshal([]byte(spec), &c); err != nil {
+		return nil, err
+	}
+	c.CurEnrolments = curEnrolments
+	return &c, nil
+}
+
+func setTags(ctx context.Context, tx *sql.Tx, campaignID string, tags []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM campaign_tags WHERE campaign_id = $1`, campaignID); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		const q = `INSERT INTO campaign_tags (campaign_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		if _, err := tx.ExecContext(ctx, q, campaignID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package sql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/stores/storetest"
+)
+
+func TestStore(t *testing.T) {
+	t.Run("SQLite", func(t *testing.T) {
+		storetest.RunSuite(t, func(t *testing.T) enforcer.Store {
+			st, err := Open(context.Background(), SQLite, filepath.Join(t.TempDir(), "enforcer.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = st.Close() })
+			return st
+		})
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		dsn := os.Getenv("ENFORCER_TEST_POSTGRES")
+		if dsn == "" {
+			t.Skip("ENFORCER_TEST_POSTGRES is not set")
+		}
+
+		storetest.RunSuite(t, func(t *testing.T) enforcer.Store {
+			st, err := Open(context.Background(), Postgres, dsn)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = st.Close() })
+
+			_, err = st.db.Exec(`TRUNCATE campaigns, campaign_tags, campaign_revisions, enrolments, ingested_actions, outbox`)
+			require.NoError(t, err)
+			return st
+		})
+	})
+}
+
+func TestOpen_Reopen(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "enforcer.db")
+
+	st, err := Open(ctx, SQLite, file)
+	require.NoError(t, err)
+	require.NoError(t, st.CreateCampaign(ctx, storetest.Campaign("persisted")))
+	require.NoError(t, st.Close())
+
+	st, err = Open(ctx, SQLite, file)
+	require.NoError(t, err)
+	defer st.Close()
+
+	c, err := st.GetCampaign(ctx, "persisted")
+	require.NoError(t, err)
+	assert.Equal(t, "persisted", c.ID)
+}
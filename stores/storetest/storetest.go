@@ -0,0 +1,870 @@
+// Package storetest provides a conformance test suite for implementations
+// of enforcer.Store.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+)
+
+// Factory must return a new, empty store instance for every invocation.
+// Any cleanup required should be registered using t.Cleanup().
+type Factory func(t *testing.T) enforcer.Store
+
+// RunSuite runs the store contract tests against stores created by the
+// factory. If the store implements enforcer.IngestLog or enforcer.RevisionStore,
+// those contracts are verified as well.
+func RunSuite(t *testing.T, factory Factory) {
+	t.Run("CampaignStore", func(t *testing.T) {
+		t.Run("GetCampaign_NotFound", func(t *testing.T) { testGetCampaignNotFound(t, factory(t)) })
+		t.Run("CreateCampaign", func(t *testing.T) { testCreateCampaign(t, factory(t)) })
+		t.Run("CreateCampaign_Conflict", func(t *testing.T) { testCreateCampaignConflict(t, factory(t)) })
+		t.Run("ListCampaigns", func(t *testing.T) { testListCampaigns(t, factory(t)) })
+		t.Run("ListCampaigns_Query", func(t *testing.T) { testListCampaignsQuery(t, factory(t)) })
+		t.Run("ListCampaigns_Pagination", func(t *testing.T) { testListCampaignsPagination(t, factory(t)) })
+		t.Run("UpdateCampaign", func(t *testing.T) { testUpdateCampaign(t, factory(t)) })
+		t.Run("UpdateCampaign_NotFound", func(t *testing.T) { testUpdateCampaignNotFound(t, factory(t)) })
+		t.Run("UpdateCampaign_Abort", func(t *testing.T) { testUpdateCampaignAbort(t, factory(t)) })
+		t.Run("UpdateCampaign_Concurrent", func(t *testing.T) { testUpdateCampaignConcurrent(t, factory(t)) })
+		t.Run("DeleteCampaign", func(t *testing.T) { testDeleteCampaign(t, factory(t)) })
+	})
+
+	t.Run("EnrolmentStore", func(t *testing.T) {
+		t.Run("GetEnrolment_NotFound", func(t *testing.T) { testGetEnrolmentNotFound(t, factory(t)) })
+		t.Run("UpsertEnrolment", func(t *testing.T) { testUpsertEnrolment(t, factory(t)) })
+		t.Run("UpsertEnrolment_MaxEnrolments", func(t *testing.T) { testUpsertEnrolmentMax(t, factory(t)) })
+		t.Run("UpsertEnrolment_Concurrent", func(t *testing.T) { testUpsertEnrolmentConcurrent(t, factory(t)) })
+		t.Run("ListEnrolments", func(t *testing.T) { testListEnrolments(t, factory(t)) })
+		t.Run("ListEnrolments_Pagination", func(t *testing.T) { testListEnrolmentsPagination(t, factory(t)) })
+		t.Run("EnrolmentHistory", func(t *testing.T) { testEnrolmentHistory(t, factory(t)) })
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		t.Run("PendingEvents", func(t *testing.T) { testOutbox(t, factory(t)) })
+		t.Run("UpsertEnrolment_Failed", func(t *testing.T) { testOutboxFailedUpsert(t, factory(t)) })
+	})
+
+	t.Run("IngestLog", func(t *testing.T) {
+		if _, ok := factory(t).(enforcer.IngestLog); !ok {
+			t.Skip("store does not implement enforcer.IngestLog")
+		}
+		t.Run("CommitIngested", func(t *testing.T) { testIngestLog(t, factory(t)) })
+		t.Run("CommitIngested_Failed", func(t *testing.T) { testIngestLogFailed(t, factory(t)) })
+		t.Run("CommitIngested_Concurrent", func(t *testing.T) { testIngestLogConcurrent(t, factory(t)) })
+		t.Run("CommitIngested_Interleaved", func(t *testing.T) { testIngestLogInterleaved(t, factory(t)) })
+	})
+
+	t.Run("RevisionStore", func(t *testing.T) {
+		st := factory(t)
+		if _, ok := st.(enforcer.RevisionStore); !ok {
+			t.Skip("store does not implement enforcer.RevisionStore")
+		}
+		testRevisions(t, st)
+	})
+}
+
+func testGetCampaignNotFound(t *testing.T, st enforcer.Store) {
+	_, err := st.GetCampaign(context.Background(), "missing")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+}
+
+func testCreateCampaign(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	want := Campaign("camp_1")
+	require.NoError(t, st.CreateCampaign(ctx, want))
+
+	got, err := st.GetCampaign(ctx, "camp_1")
+	require.NoError(t, err)
+	assertCampaign(t, want, *got)
+}
+
+func testCreateCampaignConflict(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	dup := Campaign("camp_1")
+	dup.Priority = 99
+	assertErrIs(t, st.CreateCampaign(ctx, dup), enforcer.ErrConflict)
+
+	got, err := st.GetCampaign(ctx, "camp_1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, got.Priority, "conflicting create must not overwrite")
+}
+
+func testListCampaigns(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	res, _, err := st.ListCampaigns(ctx, enforcer.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	for _, id := range []string{"camp_1", "camp_2", "camp_3"} {
+		require.NoError(t, st.CreateCampaign(ctx, Campaign(id)))
+	}
+
+	res, _, err = st.ListCampaigns(ctx, enforcer.Query{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"camp_1", "camp_2", "camp_3"}, campaignIDs(res))
+}
+
+func testListCampaignsQuery(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	active := Campaign("active")
+	active.Tags = []string{"team:test", "country:us"}
+	active.AutoEnrol = true
+
+	disabled := Campaign("disabled")
+	disabled.Enabled = false
+	disabled.AutoEnrol = true
+
+	expired := Campaign("expired")
+	expired.StartAt = now.Add(-48 * time.Hour)
+	expired.EndAt = now.Add(-24 * time.Hour)
+
+	for _, c := range []enforcer.Campaign{active, disabled, expired, Campaign("other")} {
+		require.NoError(t, st.CreateCampaign(ctx, c))
+	}
+
+	table := []struct {
+		title string
+		query enforcer.Query
+		want  []string
+	}{
+		{
+			title: "NoFilter",
+			query: enforcer.Query{},
+			want:  []string{"active", "disabled", "expired", "other"},
+		},
+		{
+			title: "OnlyActive",
+			query: enforcer.Query{OnlyActive: true},
+			want:  []string{"active", "other"},
+		},
+		{
+			title: "SearchIn",
+			query: enforcer.Query{SearchIn: []string{"active", "expired", "missing"}},
+			want:  []string{"active", "expired"},
+		},
+		{
+			title: "HavingTags",
+			query: enforcer.Query{HavingTags: []string{"team:test", "country:us"}},
+			want:  []string{"active"},
+		},
+		{
+			title: "OnlyAutoEnrol",
+			query: enforcer.Query{OnlyAutoEnrol: true},
+			want:  []string{"active", "disabled"},
+		},
+		{
+			title: "OnlyActiveAutoEnrol",
+			query: enforcer.Query{OnlyActive: true, OnlyAutoEnrol: true},
+			want:  []string{"active"},
+		},
+		{
+			title: "IncludeBypassesFilters",
+			query: enforcer.Query{
+				Include:    []string{"expired", "disabled"},
+				OnlyActive: true,
+				SearchIn:   []string{"active", "other"},
+				HavingTags: []string{"country:us"},
+			},
+			want: []string{"active", "disabled", "expired"},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			res, _, err := st.ListCampaigns(ctx, tt.query)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, campaignIDs(res))
+		})
+	}
+}
+
+func testListCampaignsPagination(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	base := time.Now().UTC().Truncate(time.Millisecond)
+	for i, id := range []string{"camp_a", "camp_b", "camp_c", "camp_d", "camp_e"} {
+		c := Campaign(id)
+		c.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		c.EndAt = base.Add(time.Duration(10-i) * time.Hour)
+		c.Priority = i % 2
+		require.NoError(t, st.CreateCampaign(ctx, c))
+	}
+
+	table := []struct {
+		title string
+		sort  string
+		want  []string
+	}{
+		{
+			title: "DefaultSort",
+			sort:  "",
+			want:  []string{"camp_a", "camp_b", "camp_c", "camp_d", "camp_e"},
+		},
+		{
+			title: "CreatedAtDesc",
+			sort:  "-" + enforcer.SortCreatedAt,
+			want:  []string{"camp_e", "camp_d", "camp_c", "camp_b", "camp_a"},
+		},
+		{
+			title: "PriorityWithIDTieBreak",
+			sort:  enforcer.SortPriority,
+			want:  []string{"camp_a", "camp_c", "camp_e", "camp_b", "camp_d"},
+		},
+		{
+			title: "EndAt",
+			sort:  enforcer.SortEndAt,
+			want:  []string{"camp_e", "camp_d", "camp_c", "camp_b", "camp_a"},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			var got []string
+			q := enforcer.Query{Sort: tt.sort, Page: enforcer.Page{Limit: 2}}
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, 3, "too many pages")
+
+				res, next, err := st.ListCampaigns(ctx, q)
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(res), 2)
+				got = append(got, campaignIDs(res)...)
+
+				if next == "" {
+					break
+				}
+				q.Cursor = next
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, _, err := st.ListCampaigns(ctx, enforcer.Query{Page: enforcer.Page{Cursor: "not-a-cursor"}})
+	assertErrIs(t, err, enforcer.ErrInvalid)
+}
+
+func testUpdateCampaign(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	updated, err := st.UpdateCampaign(ctx, "camp_1", func(ctx context.Context, actual *enforcer.Campaign) error {
+		assert.Equal(t, "camp_1", actual.ID)
+		actual.Version++
+		actual.Priority = 10
+		actual.Tags = []string{"country:us"}
+		actual.AutoEnrol = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 10, updated.Priority)
+
+	got, err := st.GetCampaign(ctx, "camp_1")
+	require.NoError(t, err)
+	assert.Equal(t, 10, got.Priority)
+	assert.Equal(t, 1, got.Version)
+	assert.Equal(t, []string{"country:us"}, got.Tags)
+
+	res, _, err := st.ListCampaigns(ctx, enforcer.Query{OnlyAutoEnrol: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"camp_1"}, campaignIDs(res), "filters must reflect the update")
+}
+
+func testUpdateCampaignNotFound(t *testing.T, st enforcer.Store) {
+	called := false
+	_, err := st.UpdateCampaign(context.Background(), "missing", func(ctx context.Context, actual *enforcer.Campaign) error {
+		called = true
+		return nil
+	})
+	assertErrIs(t, err, enforcer.ErrNotFound)
+	assert.False(t, called, "update-fn must not be invoked for non-existent campaign")
+}
+
+func testUpdateCampaignAbort(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	_, err := st.UpdateCampaign(ctx, "camp_1", func(ctx context.Context, actual *enforcer.Campaign) error {
+		actual.Priority = 10
+		return enforcer.ErrInvalid.WithMsgf("rejected")
+	})
+	assertErrIs(t, err, enforcer.ErrInvalid)
+
+	got, err := st.GetCampaign(ctx, "camp_1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, got.Priority, "failed update-fn must not be written")
+}
+
+func testUpdateCampaignConcurrent(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+	const workers = 20
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := st.UpdateCampaign(ctx, "camp_1", func(ctx context.Context, actual *enforcer.Campaign) error {
+				actual.Priority++
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	got, err := st.GetCampaign(ctx, "camp_1")
+	require.NoError(t, err)
+	assert.Equal(t, workers, got.Priority, "updates must not be lost")
+}
+
+func testDeleteCampaign(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, st.DeleteCampaign(ctx, "missing", 0))
+	assertErrIs(t, st.DeleteCampaign(ctx, "missing", 1), enforcer.ErrNotFound)
+
+	camp := Campaign("camp_1")
+	camp.Version = 2
+	require.NoError(t, st.CreateCampaign(ctx, camp))
+
+	assertErrIs(t, st.DeleteCampaign(ctx, "camp_1", 1), enforcer.ErrConflict)
+	_, err := st.GetCampaign(ctx, "camp_1")
+	require.NoError(t, err, "campaign must not be deleted on version mismatch")
+
+	require.NoError(t, st.DeleteCampaign(ctx, "camp_1", 2))
+
+	_, err = st.GetCampaign(ctx, "camp_1")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+}
+
+func testGetEnrolmentNotFound(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	_, err := st.GetEnrolment(ctx, "actor_1", "camp_1")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+}
+
+func testUpsertEnrolment(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	enr := Enrolment("actor_1", "camp_1")
+	require.NoError(t, st.UpsertEnrolment(ctx, enr))
+	assertCurEnrolments(t, st, "camp_1", 1)
+
+	enr.CompletedSteps = append(enr.CompletedSteps, enforcer.StepResult{
+		StepID:   0,
+		DoneAt:   enr.StartedAt.Add(1 * time.Minute),
+		ActionID: "act_1",
+	})
+	require.NoError(t, st.UpsertEnrolment(ctx, enr))
+	assertCurEnrolments(t, st, "camp_1", 1)
+
+	got, err := st.GetEnrolment(ctx, "actor_1", "camp_1")
+	require.NoError(t, err)
+	assert.Equal(t, "actor_1", got.ActorID)
+	assert.Equal(t, "camp_1", got.CampaignID)
+	require.Len(t, got.CompletedSteps, 1)
+	assert.Equal(t, "act_1", got.CompletedSteps[0].ActionID)
+	assert.True(t, enr.StartedAt.Equal(got.StartedAt))
+}
+
+func testUpsertEnrolmentMax(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	camp := Campaign("camp_1")
+	camp.MaxEnrolments = 1
+	require.NoError(t, st.CreateCampaign(ctx, camp))
+
+	require.NoError(t, st.UpsertEnrolment(ctx, Enrolment("actor_1", "camp_1")))
+	require.NoError(t, st.UpsertEnrolment(ctx, Enrolment("actor_1", "camp_1")),
+		"updating existing enrolment must be allowed at the limit")
+
+	err := st.UpsertEnrolment(ctx, Enrolment("actor_2", "camp_1"))
+	assertErrIs(t, err, enforcer.ErrLimitReached)
+
+	_, err = st.GetEnrolment(ctx, "actor_2", "camp_1")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+	assertCurEnrolments(t, st, "camp_1", 1)
+}
+
+func testUpsertEnrolmentConcurrent(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+	const maxEnrolments = 5
+
+	camp := Campaign("camp_1")
+	camp.MaxEnrolments = maxEnrolments
+	require.NoError(t, st.CreateCampaign(ctx, camp))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 4*maxEnrolments; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// every actor upserts twice so that both insert and update
+			// paths race with each other.
+			enr := Enrolment(fmt.Sprintf("actor_%d", i), "camp_1")
+			for j := 0; j < 2; j++ {
+				err := st.UpsertEnrolment(ctx, enr)
+				if err != nil {
+					assertErrIs(t, err, enforcer.ErrLimitReached)
+					return
+				} else if j == 0 {
+					mu.Lock()
+					created++
+					mu.Unlock()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, maxEnrolments, created)
+	assertCurEnrolments(t, st, "camp_1", maxEnrolments)
+}
+
+func testListEnrolments(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	res, _, err := st.ListEnrolments(ctx, "actor_1", enforcer.Page{})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	for _, id := range []string{"camp_1", "camp_2"} {
+		require.NoError(t, st.CreateCampaign(ctx, Campaign(id)))
+		require.NoError(t, st.UpsertEnrolment(ctx, Enrolment("actor_1", id)))
+	}
+	require.NoError(t, st.UpsertEnrolment(ctx, Enrolment("actor_2", "camp_1")))
+
+	res, _, err = st.ListEnrolments(ctx, "actor_1", enforcer.Page{})
+	require.NoError(t, err)
+
+	var ids []string
+	for _, enr := range res {
+		assert.Equal(t, "actor_1", enr.ActorID)
+		ids = append(ids, enr.CampaignID)
+	}
+	assert.ElementsMatch(t, []string{"camp_1", "camp_2"}, ids)
+}
+
+func testListEnrolmentsPagination(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	ids := []string{"camp_a", "camp_b", "camp_c"}
+	for _, id := range ids {
+		require.NoError(t, st.CreateCampaign(ctx, Campaign(id)))
+		require.NoError(t, st.UpsertEnrolment(ctx, Enrolment("actor_1", id)))
+	}
+
+	res, next, err := st.ListEnrolments(ctx, "actor_1", enforcer.Page{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.NotEmpty(t, next)
+	assert.Equal(t, "camp_a", res[0].CampaignID)
+	assert.Equal(t, "camp_b", res[1].CampaignID)
+
+	res, next, err = st.ListEnrolments(ctx, "actor_1", enforcer.Page{Limit: 2, Cursor: next})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Empty(t, next)
+	assert.Equal(t, "camp_c", res[0].CampaignID)
+}
+
+func testEnrolmentHistory(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	camp := Campaign("camp_1")
+	camp.MaxEnrolments = 1
+	require.NoError(t, st.CreateCampaign(ctx, camp))
+
+	history, err := st.ListEnrolmentHistory(ctx, "actor_1", "camp_1")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	enr := Enrolment("actor_1", "camp_1")
+	enr.Iteration = 1
+	err = st.UpsertEnrolment(ctx, enr)
+	assertErrIs(t, err, enforcer.ErrConflict)
+
+	for i := 0; i < 3; i++ {
+		enr.Iteration = i
+		require.NoError(t, st.UpsertEnrolment(ctx, enr), "iteration %d", i)
+	}
+	assertCurEnrolments(t, st, "camp_1", 1)
+
+	enr.Iteration = 5
+	err = st.UpsertEnrolment(ctx, enr)
+	assertErrIs(t, err, enforcer.ErrConflict)
+
+	// updating a past iteration must not affect the latest one.
+	enr.Iteration = 1
+	enr.TotalSteps = 2
+	require.NoError(t, st.UpsertEnrolment(ctx, enr))
+
+	got, err := st.GetEnrolment(ctx, "actor_1", "camp_1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Iteration)
+	assert.Equal(t, 1, got.TotalSteps)
+
+	list, _, err := st.ListEnrolments(ctx, "actor_1", enforcer.Page{})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, 2, list[0].Iteration)
+
+	history, err = st.ListEnrolmentHistory(ctx, "actor_1", "camp_1")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	for i, h := range history {
+		assert.Equal(t, i, h.Iteration)
+	}
+	assert.Equal(t, 2, history[1].TotalSteps)
+}
+
+func testOutbox(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	events, err := st.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	enr := Enrolment("actor_1", "camp_1")
+	require.NoError(t, st.UpsertEnrolment(ctx, enr, Event("evt_1", enr), Event("evt_2", enr)))
+	require.NoError(t, st.UpsertEnrolment(ctx, enr, Event("evt_3", enr)))
+	require.NoError(t, st.UpsertEnrolment(ctx, enr, Event("evt_1", enr)),
+		"recording an event again must be ignored")
+
+	events, err = st.PendingEvents(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"evt_1", "evt_2"}, eventIDs(events))
+	assert.Equal(t, "camp_1", events[0].Enrolment.CampaignID)
+
+	require.NoError(t, st.AckEvents(ctx, []string{"evt_1", "evt_2", "evt_unknown"}))
+
+	events, err = st.PendingEvents(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"evt_3"}, eventIDs(events))
+
+	require.NoError(t, st.AckEvents(ctx, []string{"evt_3"}))
+	events, err = st.PendingEvents(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func testOutboxFailedUpsert(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+
+	camp := Campaign("camp_1")
+	camp.MaxEnrolments = 1
+	require.NoError(t, st.CreateCampaign(ctx, camp))
+	require.NoError(t, st.UpsertEnrolment(ctx, Enrolment("actor_1", "camp_1")))
+
+	enr := Enrolment("actor_2", "camp_1")
+	err := st.UpsertEnrolment(ctx, enr, Event("evt_1", enr))
+	assertErrIs(t, err, enforcer.ErrLimitReached)
+
+	events, err := st.PendingEvents(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, events, "events must not be recorded if the enrolment write fails")
+}
+
+func testRevisions(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+	revs := st.(enforcer.RevisionStore)
+
+	camp := Campaign("camp_1")
+	camp.Version = 1
+	require.NoError(t, st.CreateCampaign(ctx, camp))
+
+	for i := 1; i <= 2; i++ {
+		_, err := st.UpdateCampaign(ctx, "camp_1", func(ctx context.Context, actual *enforcer.Campaign) error {
+			actual.Version++
+			actual.Priority = i
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	// updates that do not change the version are not revisions.
+	_, err := st.UpdateCampaign(ctx, "camp_1", func(ctx context.Context, actual *enforcer.Campaign) error {
+		actual.Enabled = false
+		return nil
+	})
+	require.NoError(t, err)
+
+	list, err := revs.ListRevisions(ctx, "camp_1")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, 1, list[0].Version)
+	assert.Equal(t, 0, list[0].Priority)
+	assert.Equal(t, 2, list[1].Version)
+	assert.Equal(t, 1, list[1].Priority)
+
+	got, err := revs.GetRevision(ctx, "camp_1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Priority)
+
+	_, err = revs.GetRevision(ctx, "camp_1", 3)
+	assertErrIs(t, err, enforcer.ErrNotFound)
+
+	require.NoError(t, st.DeleteCampaign(ctx, "camp_1", 0))
+	list, err = revs.ListRevisions(ctx, "camp_1")
+	require.NoError(t, err)
+	assert.Empty(t, list, "revisions must be deleted with the campaign")
+}
+
+func testIngestLog(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+	log := st.(enforcer.IngestLog)
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	_, err := log.GetIngested(ctx, "actor_1", "act_1")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+
+	enr := Enrolment("actor_1", "camp_1")
+	evt := enforcer.Event{ID: "evt_1", Type: enforcer.EventEnrolled, ActorID: "actor_1", CampaignID: "camp_1"}
+	want := []enforcer.IngestResult{{StepID: 1, ActionID: "act_1", CampaignID: "camp_1"}}
+	require.NoError(t, log.CommitIngested(ctx, "actor_1", "act_1", want, []enforcer.Enrolment{enr}, []enforcer.Event{evt}))
+	require.NoError(t, log.CommitIngested(ctx, "actor_1", "act_2", nil, nil, nil))
+
+	got, err := log.GetIngested(ctx, "actor_1", "act_1")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	got, err = log.GetIngested(ctx, "actor_1", "act_2")
+	require.NoError(t, err, "action with no results must be recorded")
+	assert.Empty(t, got)
+
+	_, err = log.GetIngested(ctx, "actor_2", "act_1")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+
+	_, err = st.GetEnrolment(ctx, "actor_1", "camp_1")
+	require.NoError(t, err, "enrolment must be committed with the action")
+	assertCurEnrolments(t, st, "camp_1", 1)
+
+	pending, err := st.PendingEvents(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "evt_1", pending[0].ID)
+
+	err = log.CommitIngested(ctx, "actor_1", "act_1", nil, nil, nil)
+	assertErrIs(t, err, enforcer.ErrConflict)
+
+	got, err = log.GetIngested(ctx, "actor_1", "act_1")
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "recorded results must not be replaced")
+}
+
+func testIngestLogFailed(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+	log := st.(enforcer.IngestLog)
+
+	camp := Campaign("camp_2")
+	camp.MaxEnrolments = 1
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+	require.NoError(t, st.CreateCampaign(ctx, camp))
+	require.NoError(t, st.UpsertEnrolment(ctx, Enrolment("actor_2", "camp_2")))
+
+	enrolments := []enforcer.Enrolment{Enrolment("actor_1", "camp_1"), Enrolment("actor_1", "camp_2")}
+	evt := enforcer.Event{ID: "evt_1", Type: enforcer.EventEnrolled, ActorID: "actor_1", CampaignID: "camp_1"}
+	err := log.CommitIngested(ctx, "actor_1", "act_1", nil, enrolments, []enforcer.Event{evt})
+	assertErrIs(t, err, enforcer.ErrLimitReached)
+
+	_, err = log.GetIngested(ctx, "actor_1", "act_1")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+
+	_, err = st.GetEnrolment(ctx, "actor_1", "camp_1")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+	assertCurEnrolments(t, st, "camp_1", 0)
+
+	pending, err := st.PendingEvents(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, pending, "events of a failed commit must not be recorded")
+}
+
+func testIngestLogConcurrent(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+	log := st.(enforcer.IngestLog)
+	const workers = 10
+
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_1")))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	committed := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// every worker commits the same action with its own event so
+			// that a duplicate commit would show up in the outbox.
+			enr := Enrolment("actor_1", "camp_1")
+			evt := enforcer.Event{ID: fmt.Sprintf("evt_%d", i), Type: enforcer.EventEnrolled, ActorID: "actor_1", CampaignID: "camp_1"}
+			err := log.CommitIngested(ctx, "actor_1", "act_1", nil, []enforcer.Enrolment{enr}, []enforcer.Event{evt})
+			if err != nil {
+				assertErrIs(t, err, enforcer.ErrConflict)
+				return
+			}
+			mu.Lock()
+			committed++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, committed, "action must be committed exactly once")
+	assertCurEnrolments(t, st, "camp_1", 1)
+
+	pending, err := st.PendingEvents(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
+
+func testIngestLogInterleaved(t *testing.T, st enforcer.Store) {
+	ctx := context.Background()
+	log := st.(enforcer.IngestLog)
+
+	camp := Campaign("camp_1")
+	camp.Steps = append(camp.Steps, enforcer.Step{Rule: "true"})
+	require.NoError(t, st.CreateCampaign(ctx, camp))
+
+	base := Enrolment("actor_1", "camp_1")
+	base.TotalSteps = 2
+	require.NoError(t, st.UpsertEnrolment(ctx, base))
+
+	// both actions are worked out from the same version of the enrolment.
+	first, second := base, base
+	first.Version, second.Version = 2, 2
+	first.CompletedSteps = []enforcer.StepResult{{StepID: 0, ActionID: "act_1"}}
+	second.CompletedSteps = []enforcer.StepResult{{StepID: 1, ActionID: "act_2"}}
+
+	require.NoError(t, log.CommitIngested(ctx, "actor_1", "act_1", nil, []enforcer.Enrolment{first}, nil))
+	err := log.CommitIngested(ctx, "actor_1", "act_2", nil, []enforcer.Enrolment{second}, nil)
+	assertErrIs(t, err, enforcer.ErrConflict)
+
+	_, err = log.GetIngested(ctx, "actor_1", "act_2")
+	assertErrIs(t, err, enforcer.ErrNotFound)
+
+	got, err := st.GetEnrolment(ctx, "actor_1", "camp_1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Version)
+	assert.Equal(t, first.CompletedSteps, got.CompletedSteps, "stale commit must not overwrite the enrolment")
+
+	// a new enrolment committed concurrently by two actions.
+	require.NoError(t, st.CreateCampaign(ctx, Campaign("camp_2")))
+	enr := Enrolment("actor_1", "camp_2")
+	require.NoError(t, log.CommitIngested(ctx, "actor_1", "act_3", nil, []enforcer.Enrolment{enr}, nil))
+	err = log.CommitIngested(ctx, "actor_1", "act_4", nil, []enforcer.Enrolment{enr}, nil)
+	assertErrIs(t, err, enforcer.ErrConflict)
+	assertCurEnrolments(t, st, "camp_2", 1)
+}
+
+// Campaign returns a valid, active campaign with given ID.
+func Campaign(id string) enforcer.Campaign {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return enforcer.Campaign{
+		ID:        id,
+		Tags:      []string{"team:test"},
+		CreatedAt: now,
+		UpdatedAt: now,
+		Enabled:   true,
+		StartAt:   now.Add(-1 * time.Hour),
+		EndAt:     now.Add(24 * time.Hour),
+		Steps:     []enforcer.Step{{Rule: "event.type == 'PURCHASE'"}},
+	}
+}
+
+// Enrolment returns an active enrolment for the actor and campaign.
+func Enrolment(actorID, campaignID string) enforcer.Enrolment {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return enforcer.Enrolment{
+		Status:     enforcer.StatusActive,
+		ActorID:    actorID,
+		CampaignID: campaignID,
+		Version:    1,
+		StartedAt:  now,
+		EndsAt:     now.Add(24 * time.Hour),
+		TotalSteps: 1,
+	}
+}
+
+// Event returns an enrolled event with given ID for the enrolment.
+func Event(id string, enr enforcer.Enrolment) enforcer.Event {
+	return enforcer.Event{
+		ID:         id,
+		Type:       enforcer.EventEnrolled,
+		Time:       enr.StartedAt,
+		ActorID:    enr.ActorID,
+		CampaignID: enr.CampaignID,
+		Enrolment:  enr,
+	}
+}
+
+func assertCampaign(t *testing.T, want, got enforcer.Campaign) {
+	t.Helper()
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.Tags, got.Tags)
+	assert.Equal(t, want.Enabled, got.Enabled)
+	assert.Equal(t, want.Steps, got.Steps)
+	assert.Equal(t, want.Priority, got.Priority)
+	assert.Equal(t, want.MaxEnrolments, got.MaxEnrolments)
+	assert.True(t, want.StartAt.Equal(got.StartAt), "start_at mismatch")
+	assert.True(t, want.EndAt.Equal(got.EndAt), "end_at mismatch")
+}
+
+func assertCurEnrolments(t *testing.T, st enforcer.Store, campaignID string, want int) {
+	t.Helper()
+	c, err := st.GetCampaign(context.Background(), campaignID)
+	require.NoError(t, err)
+	assert.Equal(t, want, c.CurEnrolments)
+}
+
+func assertErrIs(t *testing.T, err, want error) {
+	t.Helper()
+	assert.Truef(t, errors.Is(err, want), "wanted '%v', got '%v'", want, err)
+}
+
+func campaignIDs(camps []enforcer.Campaign) []string {
+	var ids []string
+	for _, c := range camps {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func eventIDs(events []enforcer.Event) []string {
+	var ids []string
+	for _, evt := range events {
+		ids = append(ids, evt.ID)
+	}
+	return ids
+}
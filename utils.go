@@ -1,5 +1,7 @@
 package enforcer
 
+import "strings"
+
 func contains(arr []string, item string) bool {
 	for _, s := range arr {
 		if s == item {
@@ -51,3 +53,45 @@ func collectCampaignIDs(existing []Enrolment) []string {
 	}
 	return res
 }
+
+// lookup returns the value at the dot-separated path in the data.
+func lookup(data map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	for i, key := range keys {
+		v, found := data[key]
+		if !found {
+			return nil, false
+		} else if i == len(keys)-1 {
+			return v, true
+		}
+
+		data, found = v.(map[string]interface{})
+		if !found {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
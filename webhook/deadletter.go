@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var _ DeadLetterStore = (*DirStore)(nil)
+
+// DeadLetter is the record of a delivery that failed even after all the
+// attempts. Payload is retained so that the event can be redelivered.
+type DeadLetter struct {
+	Delivery
+	Payload json.RawMessage `json:"payload"`
+}
+
+// DeadLetterStore persists dead letters.
+type DeadLetterStore interface {
+	PutDeadLetter(ctx context.Context, dl DeadLetter) error
+}
+
+// DirStore persists every dead letter as a JSON file (named by the delivery
+// ID) in a directory. Oldest files are removed once there are more than Max
+// files in the directory.
+type DirStore struct {
+	Path string
+	Max  int // default: 1000
+
+	mu sync.Mutex
+}
+
+// PutDeadLetter writes the dead letter to a file in the directory. File is
+// written to a temporary file first and renamed, so that a partially written
+// file is never seen.
+func (ds *DirStore) PutDeadLetter(_ context.Context, dl DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if err := os.MkdirAll(ds.Path, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(ds.Path, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(ds.Path, dl.ID+".json")); err != nil {
+		return err
+	}
+	return ds.prune()
+}
+
+// List returns the persisted dead letters (oldest first).
+func (ds *DirStore) List() ([]DeadLetter, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	names, err := ds.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []DeadLetter
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(ds.Path, name))
+		if err != nil {
+			return nil, err
+		}
+
+		var dl DeadLetter
+		if err := json.Unmarshal(data, &dl); err != nil {
+			return nil, err
+		}
+		res = append(res, dl)
+	}
+	return res, nil
+}
+
+// prune removes the oldest files beyond the max. Delivery IDs start with the
+// creation time, so the names sort in the order of creation.
+func (ds *DirStore) prune() error {
+	max := ds.Max
+	if max <= 0 {
+		max = 1000
+	}
+
+	names, err := ds.files()
+	if err != nil {
+		return err
+	}
+
+	for len(names) > max {
+		if err := os.Remove(filepath.Join(ds.Path, names[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+func (ds *DirStore) files() ([]string, error) {
+	entries, err := os.ReadDir(ds.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return lessID(names[i], names[j]) })
+	return names, nil
+}
+
+// lessID compares the file names by the creation time and sequence in the
+// delivery IDs ("<unix-nanos>-<seq>"), which may differ in length.
+func lessID(a, b string) bool {
+	a, b = strings.TrimSuffix(a, ".json"), strings.TrimSuffix(b, ".json")
+	ap, bp := strings.SplitN(a, "-", 2), strings.SplitN(b, "-", 2)
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		if len(ap[i]) != len(bp[i]) {
+			return len(ap[i]) < len(bp[i])
+		}
+		if ap[i] != bp[i] {
+			return ap[i] < bp[i]
+		}
+	}
+	return len(ap) < len(bp)
+}
@@ -0,0 +1,430 @@
+// Package webhook provides an enforcer.Publisher that delivers enrolment
+// lifecycle events to HTTP endpoints as HMAC-signed JSON payloads.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/spy16/enforcer"
+)
+
+// Headers set on every delivery request.
+const (
+	HeaderEvent     = "X-Enforcer-Event"
+	HeaderDelivery  = "X-Enforcer-Delivery"
+	HeaderTimestamp = "X-Enforcer-Timestamp"
+	HeaderSignature = "X-Enforcer-Signature"
+)
+
+// Status of deliveries.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+var _ enforcer.Publisher = (*Dispatcher)(nil)
+
+// Endpoint represents a receiver of webhook deliveries.
+type Endpoint struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+
+	// Events to deliver to the endpoint. All events are delivered if
+	// empty.
+	Events []string `json:"events,omitempty"`
+}
+
+// Config represents the configuration for the dispatcher. Zero values
+// are replaced by defaults.
+type Config struct {
+	Endpoints   []Endpoint
+	Workers     int           // default: 4
+	QueueSize   int           // default: 1000
+	MaxAttempts int           // default: 5
+	Backoff     time.Duration // default: 1s (doubled after every attempt)
+	MaxBackoff  time.Duration // default: 1m
+	HistorySize int           // default: 1000
+	Client      *http.Client  // default: client with 10s timeout
+
+	// DeadLetters persists the deliveries that fail even after all the
+	// attempts. Events with such deliveries are not published until the
+	// dead letters are persisted. Without a store, such events are never
+	// published, which stalls a Relay (and every other publisher of it)
+	// at the first of them.
+	DeadLetters DeadLetterStore
+}
+
+// Delivery represents the delivery of an event to an endpoint. Deliveries
+// that fail even after all attempts are marked with StatusDead and are
+// persisted to Config.DeadLetters along with the payload.
+type Delivery struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	URL        string    `json:"url"`
+	Status     string    `json:"status"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	payload  []byte
+	endpoint Endpoint
+	done     chan struct{}
+	err      error // reason the delivery is not done.
+}
+
+// New returns a dispatcher for the config. Dispatcher.Run must be invoked
+// for the deliveries to be made.
+func New(cfg Config) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 1 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 1 * time.Minute
+	}
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = 1000
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	d := &Dispatcher{
+		cfg:   cfg,
+		queue: make(chan *Delivery, cfg.QueueSize),
+	}
+	d.restore()
+	return d
+}
+
+// Dispatcher delivers events to the configured endpoints with retries. It
+// implements enforcer.Publisher.
+type Dispatcher struct {
+	cfg   Config
+	queue chan *Delivery
+
+	mu      sync.RWMutex
+	seq     int64
+	history []*Delivery
+}
+
+// Publish queues deliveries of the events to all interested endpoints and
+// blocks until all of them are delivered (by the workers started by Run) or
+// persisted as dead letters. An error is returned if any of the deliveries
+// is not done or if the queue is full, so that the events are published
+// again later.
+func (d *Dispatcher) Publish(ctx context.Context, events []enforcer.Event) error {
+	var queued []*Delivery
+	if err := d.enqueue(events, &queued); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, del := range queued {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-del.done:
+		}
+
+		if del.err != nil {
+			failed++
+			log.Warn().Err(del.err).
+				Str("delivery_id", del.ID).
+				Str("event_id", del.EventID).
+				Msg("webhook delivery is not done")
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d webhook deliveries are not done", failed)
+	}
+	return nil
+}
+
+// enqueue queues deliveries of the events. Deliveries that are queued are
+// appended to queued even if an error is returned.
+func (d *Dispatcher) enqueue(events []enforcer.Event, queued *[]*Delivery) error {
+	for _, evt := range events {
+		payload, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+
+		for _, ep := range d.cfg.Endpoints {
+			if len(ep.Events) > 0 && !contains(ep.Events, evt.Type) {
+				continue
+			}
+
+			del := d.record(evt, ep, payload)
+			select {
+			case d.queue <- del:
+				*queued = append(*queued, del)
+			default:
+				d.forget(del)
+				return fmt.Errorf("webhook delivery queue is full")
+			}
+		}
+	}
+	return nil
+}
+
+// Deliveries returns the recorded deliveries (most recent first) in the
+// given status. All deliveries are returned if status is empty.
+func (d *Dispatcher) Deliveries(status string) []Delivery {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var res []Delivery
+	for i := len(d.history) - 1; i >= 0; i-- {
+		if status == "" || d.history[i].Status == status {
+			res = append(res, *d.history[i])
+		}
+	}
+	return res
+}
+
+// Run starts the delivery workers and blocks until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < d.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case del := <-d.queue:
+					d.deliver(ctx, del)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del *Delivery) {
+	defer d.finish(ctx, del)
+
+	backoff := d.cfg.Backoff
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		code, err := d.send(ctx, del)
+		d.update(del, func(del *Delivery) {
+			del.Attempts = attempt
+			del.StatusCode = code
+			if err == nil {
+				del.Status = StatusDelivered
+				del.LastError = ""
+			} else {
+				del.LastError = err.Error()
+				if attempt == d.cfg.MaxAttempts {
+					del.Status = StatusDead
+				}
+			}
+		})
+		if err == nil {
+			return
+		}
+		log.Warn().Err(err).Str("delivery_id", del.ID).Int("attempt", attempt).Msg("webhook delivery failed")
+
+		if attempt < d.cfg.MaxAttempts {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > d.cfg.MaxBackoff {
+				backoff = d.cfg.MaxBackoff
+			}
+		}
+	}
+}
+
+// finish persists the dead delivery as a dead letter, drops the payload
+// and releases the publisher waiting for the delivery.
+func (d *Dispatcher) finish(ctx context.Context, del *Delivery) {
+	d.mu.RLock()
+	status, lastErr := del.Status, del.LastError
+	d.mu.RUnlock()
+
+	var err error
+	switch {
+	case status == StatusPending:
+		err = fmt.Errorf("delivery is interrupted")
+
+	case status == StatusDead && d.cfg.DeadLetters == nil:
+		err = fmt.Errorf("delivery failed: %s", lastErr)
+
+	case status == StatusDead:
+		dl := DeadLetter{Delivery: d.snapshot(del), Payload: del.payload}
+		if putErr := d.cfg.DeadLetters.PutDeadLetter(ctx, dl); putErr != nil {
+			err = fmt.Errorf("failed to persist dead letter: %w", putErr)
+		}
+	}
+
+	d.update(del, func(del *Delivery) {
+		del.err = err
+		del.payload = nil
+	})
+	close(del.done)
+}
+
+func (d *Dispatcher) send(ctx context.Context, del *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.endpoint.URL, bytes.NewReader(del.payload))
+	if err != nil {
+		return 0, err
+	}
+
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, del.EventType)
+	req.Header.Set(HeaderDelivery, del.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(del.endpoint.Secret, ts, del.payload))
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) record(evt enforcer.Event, ep Endpoint, payload []byte) *Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.seq++
+	now := time.Now()
+	del := &Delivery{
+		ID:        fmt.Sprintf("%d-%d", now.UnixNano(), d.seq),
+		EventID:   evt.ID,
+		EventType: evt.Type,
+		URL:       ep.URL,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+		payload:   payload,
+		endpoint:  ep,
+		done:      make(chan struct{}),
+	}
+	d.history = append(d.history, del)
+
+	// evict the oldest finished entries beyond the history size. pending
+	// deliveries are bounded by the queue and are always retained.
+	for i := 0; len(d.history) > d.cfg.HistorySize && i < len(d.history); {
+		if d.history[i].Status != StatusPending {
+			d.history = append(d.history[:i], d.history[i+1:]...)
+		} else {
+			i++
+		}
+	}
+	return del
+}
+
+// forget removes the delivery that could not be queued.
+func (d *Dispatcher) forget(del *Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i := range d.history {
+		if d.history[i] == del {
+			d.history = append(d.history[:i], d.history[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) snapshot(del *Delivery) Delivery {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return *del
+}
+
+// restore loads the dead letters persisted earlier (if the store can list
+// them) into the history, so that they are listed after a restart too.
+func (d *Dispatcher) restore() {
+	lister, ok := d.cfg.DeadLetters.(interface {
+		List() ([]DeadLetter, error)
+	})
+	if !ok {
+		return
+	}
+
+	dls, err := lister.List()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load webhook dead letters")
+		return
+	}
+	if len(dls) > d.cfg.HistorySize {
+		dls = dls[len(dls)-d.cfg.HistorySize:]
+	}
+	for _, dl := range dls {
+		del := dl.Delivery
+		d.history = append(d.history, &del)
+	}
+}
+
+func (d *Dispatcher) update(del *Delivery, fn func(del *Delivery)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(del)
+	del.UpdatedAt = time.Now()
+}
+
+// Sign returns the signature of the payload sent at the given unix time.
+// Signature is the hex-encoded HMAC-SHA256 of "<timestamp>.<payload>" and
+// is prefixed with the scheme version (i.e., "v1=").
+func Sign(secret string, ts int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%d.", ts)
+	_, _ = mac.Write(payload)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if the signature matches the payload. Receivers should
+// also reject deliveries with a timestamp too far from the current time.
+func Verify(secret string, ts int64, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, ts, payload)), []byte(signature))
+}
+
+func contains(arr []string, item string) bool {
+	for _, s := range arr {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
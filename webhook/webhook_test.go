@@ -0,0 +1,297 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/enforcer"
+	"github.com/spy16/enforcer/publisher"
+	"github.com/spy16/enforcer/stores/inmem"
+	"github.com/spy16/enforcer/webhook"
+)
+
+func TestDispatcher_Deliver(t *testing.T) {
+	t.Parallel()
+
+	const secret = "s3cr3t"
+
+	var mu sync.Mutex
+	var received []enforcer.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		ts, err := strconv.ParseInt(req.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		if !webhook.Verify(secret, ts, body, req.Header.Get(webhook.HeaderSignature)) {
+			wr.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var evt enforcer.Event
+		require.NoError(t, json.Unmarshal(body, &evt))
+		assert.Equal(t, evt.Type, req.Header.Get(webhook.HeaderEvent))
+
+		mu.Lock()
+		received = append(received, evt)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	deadLetters := &webhook.DirStore{Path: t.TempDir()}
+	d := webhook.New(webhook.Config{
+		Endpoints: []webhook.Endpoint{
+			{URL: srv.URL, Secret: secret, Events: []string{enforcer.EventCampaignCompleted}},
+			{URL: srv.URL, Secret: "wrong", Events: []string{enforcer.EventEnrolled}},
+		},
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		DeadLetters: deadLetters,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = d.Run(ctx) }()
+
+	err := d.Publish(ctx, []enforcer.Event{
+		{ID: "evt_1", Type: enforcer.EventCampaignCompleted, ActorID: "actor_1", CampaignID: "camp_1"},
+		{ID: "evt_2", Type: enforcer.EventEnrolled, ActorID: "actor_1", CampaignID: "camp_1"},
+		{ID: "evt_3", Type: enforcer.EventExpired, ActorID: "actor_1", CampaignID: "camp_1"},
+	})
+	require.NoError(t, err, "publish must succeed once the failed delivery is dead-lettered")
+	assert.Empty(t, d.Deliveries(webhook.StatusPending))
+
+	delivered := d.Deliveries(webhook.StatusDelivered)
+	require.Len(t, delivered, 1)
+	assert.Equal(t, "evt_1", delivered[0].EventID)
+	assert.Equal(t, 1, delivered[0].Attempts)
+
+	dead := d.Deliveries(webhook.StatusDead)
+	require.Len(t, dead, 1, "bad signature must be retried and dead-lettered")
+	assert.Equal(t, "evt_2", dead[0].EventID)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, http.StatusUnauthorized, dead[0].StatusCode)
+
+	persisted, err := deadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, persisted, 1)
+	assert.Equal(t, dead[0].ID, persisted[0].ID)
+	assert.Equal(t, webhook.StatusDead, persisted[0].Status)
+
+	var evt enforcer.Event
+	require.NoError(t, json.Unmarshal(persisted[0].Payload, &evt))
+	assert.Equal(t, "evt_2", evt.ID)
+
+	restarted := webhook.New(webhook.Config{DeadLetters: deadLetters})
+	dead = restarted.Deliveries(webhook.StatusDead)
+	require.Len(t, dead, 1, "dead letters must be listed after a restart")
+	assert.Equal(t, persisted[0].ID, dead[0].ID)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1)
+	assert.Equal(t, "evt_1", received[0].ID)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if calls++; calls < 3 {
+			wr.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	d := webhook.New(webhook.Config{
+		Endpoints:   []webhook.Endpoint{{URL: srv.URL, Secret: "secret"}},
+		MaxAttempts: 5,
+		Backoff:     time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = d.Run(ctx) }()
+
+	require.NoError(t, d.Publish(ctx, []enforcer.Event{{ID: "evt_1", Type: enforcer.EventEnrolled}}))
+
+	delivered := d.Deliveries(webhook.StatusDelivered)
+	require.Len(t, delivered, 1)
+	assert.Equal(t, 3, delivered[0].Attempts)
+}
+
+func TestDispatcher_Dead(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		wr.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	d := webhook.New(webhook.Config{
+		Endpoints:   []webhook.Endpoint{{URL: srv.URL, Secret: "secret"}},
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = d.Run(ctx) }()
+
+	err := d.Publish(ctx, []enforcer.Event{{ID: "evt_1", Type: enforcer.EventEnrolled}})
+	assert.Error(t, err, "events must not be acked without a dead-letter store")
+
+	dead := d.Deliveries(webhook.StatusDead)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 2, dead[0].Attempts)
+}
+
+func TestDispatcher_Relay(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var received []string
+	healthy := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, req.Header.Get(webhook.HeaderDelivery))
+	}))
+	defer healthy.Close()
+
+	dead := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		wr.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+
+	deadLetters := &webhook.DirStore{Path: t.TempDir()}
+	d := webhook.New(webhook.Config{
+		Endpoints: []webhook.Endpoint{
+			{URL: healthy.URL, Secret: "secret"},
+			{URL: dead.URL, Secret: "secret"},
+		},
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		DeadLetters: deadLetters,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = d.Run(ctx) }()
+
+	store := &inmem.Store{}
+	enr := enforcer.Enrolment{ActorID: "actor_1", CampaignID: "camp_1", Version: 1}
+	require.NoError(t, store.UpsertEnrolment(ctx, enr,
+		enforcer.Event{ID: "evt_1", Type: enforcer.EventEnrolled, ActorID: "actor_1", CampaignID: "camp_1"},
+		enforcer.Event{ID: "evt_2", Type: enforcer.EventExpired, ActorID: "actor_1", CampaignID: "camp_1"},
+	))
+
+	mem := &publisher.Memory{}
+	relay := &enforcer.Relay{Outbox: store, Publisher: publisher.Multi(d, mem)}
+
+	n, err := relay.Drain(ctx)
+	require.NoError(t, err, "a dead endpoint must not stall the outbox")
+	assert.Equal(t, 2, n)
+
+	n, err = relay.Drain(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "events must not be published again")
+
+	assert.Len(t, mem.Events(), 2)
+	mu.Lock()
+	assert.Len(t, received, 2)
+	mu.Unlock()
+
+	persisted, err := deadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, persisted, 2)
+	assert.Equal(t, dead.URL, persisted[0].URL)
+}
+
+func TestDispatcher_History(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	d := webhook.New(webhook.Config{
+		Endpoints:   []webhook.Endpoint{{URL: srv.URL, Secret: "secret"}},
+		HistorySize: 2,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = d.Run(ctx) }()
+
+	for _, id := range []string{"evt_1", "evt_2", "evt_3"} {
+		require.NoError(t, d.Publish(ctx, []enforcer.Event{{ID: id, Type: enforcer.EventEnrolled}}))
+	}
+
+	all := d.Deliveries("")
+	require.Len(t, all, 2)
+	assert.Equal(t, "evt_3", all[0].EventID)
+	assert.Equal(t, "evt_2", all[1].EventID)
+}
+
+func TestDispatcher_QueueFull(t *testing.T) {
+	t.Parallel()
+
+	d := webhook.New(webhook.Config{
+		Endpoints: []webhook.Endpoint{{URL: "http://localhost", Secret: "secret"}},
+		QueueSize: 1,
+	})
+
+	// workers are not running, so the delivery stays queued.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := d.Publish(ctx, []enforcer.Event{{ID: "evt_1", Type: enforcer.EventEnrolled}})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "publish must not succeed before delivery")
+
+	err = d.Publish(context.Background(), []enforcer.Event{{ID: "evt_2", Type: enforcer.EventEnrolled}})
+	assert.Error(t, err)
+
+	pending := d.Deliveries(webhook.StatusPending)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "evt_1", pending[0].EventID)
+}
+
+func TestDirStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ds := &webhook.DirStore{Path: t.TempDir(), Max: 2}
+	for _, id := range []string{"9-1", "10-2", "10-3"} {
+		dl := webhook.DeadLetter{
+			Delivery: webhook.Delivery{ID: id, Status: webhook.StatusDead},
+			Payload:  json.RawMessage(`{"id":"evt_` + id + `"}`),
+		}
+		require.NoError(t, ds.PutDeadLetter(ctx, dl))
+	}
+
+	got, err := ds.List()
+	require.NoError(t, err)
+	require.Len(t, got, 2, "oldest dead letters beyond max must be removed")
+	assert.Equal(t, "10-2", got[0].ID)
+	assert.Equal(t, "10-3", got[1].ID)
+	assert.JSONEq(t, `{"id":"evt_10-3"}`, string(got[1].Payload))
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	payload := []byte(`{"id":"evt_1"}`)
+	sig := webhook.Sign("secret", 1644000000, payload)
+
+	assert.True(t, webhook.Verify("secret", 1644000000, payload, sig))
+	assert.False(t, webhook.Verify("secret", 1644000001, payload, sig))
+	assert.False(t, webhook.Verify("other", 1644000000, payload, sig))
+	assert.False(t, webhook.Verify("secret", 1644000000, []byte(`{}`), sig))
+}